@@ -0,0 +1,196 @@
+package main
+
+import (
+	"net"
+	"strings"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/conf"
+	"github.com/Lyxot/CloudflareSpeedTestDNS/task"
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+// ipPool 定时任务中维护的 IP 池
+type ipPool struct {
+	published utils.DownloadSpeedSet // 已同步到 DNS 的 IP
+	reserve   utils.DownloadSpeedSet // 候补 IP，即上一轮测速结果中未发布的 IP（保持原有排名）
+}
+
+// newIPPool 根据完整测速结果及已发布的 IP 创建 IP 池
+func newIPPool(ipData []string, results utils.DownloadSpeedSet) *ipPool {
+	publishedMap := make(map[string]bool, len(ipData))
+	for _, ip := range ipData {
+		publishedMap[ip] = true
+	}
+	pool := &ipPool{}
+	for _, data := range results {
+		if publishedMap[data.IP.String()] {
+			pool.published = append(pool.published, data)
+		} else {
+			pool.reserve = append(pool.reserve, data)
+		}
+	}
+	return pool
+}
+
+// ips 返回已发布的 IP 列表
+func (p *ipPool) ips() []string {
+	ips := make([]string, 0, len(p.published))
+	for _, data := range p.published {
+		ips = append(ips, data.IP.String())
+	}
+	return ips
+}
+
+// healthCheck 使用定时任务的延迟、丢包率阈值（及开启 speed_check 时的下载速度阈值）检查指定 IP，返回符合条件的 IP 数据
+// 检查失败的 IP 会被加入临时黑名单，避免在之后的完整测速中再次被选中
+func healthCheck(ips []string) map[string]*utils.PingData {
+	result := make(map[string]*utils.PingData)
+	if len(ips) == 0 { // IPText 为空时会改为读取 IP 段数据文件，因此直接返回
+		return result
+	}
+
+	// 保存原始设置
+	origIPText := task.IPText
+	origMaxDelay := utils.InputMaxDelay
+	origMaxLossRate := utils.InputMaxLossRate
+
+	task.IPText = strings.Join(ips, ",")
+	utils.InputMaxDelay = conf.LatencyThreshold
+	utils.InputMaxLossRate = conf.LossRateThreshold
+	pingData := task.NewPing().Run().FilterDelay().FilterLossRate().FilterTLS().FilterStats()
+
+	// 恢复原始设置
+	task.IPText = origIPText
+	utils.InputMaxDelay = origMaxDelay
+	utils.InputMaxLossRate = origMaxLossRate
+
+	for _, data := range pingData {
+		if conf.SpeedCheck && !speedCheck(data.IP) {
+			continue
+		}
+		result[data.IP.String()] = data.PingData
+	}
+
+	var failed []string
+	for _, ip := range ips {
+		if _, ok := result[ip]; !ok {
+			failed = append(failed, ip)
+		}
+	}
+	task.BlacklistIPs(failed)
+	return result
+}
+
+// speedCheck 对指定 IP 进行轻量下载测速，检查下载速度是否达到定时任务的下载速度阈值（下载失败时视为未达到）
+func speedCheck(ip *net.IPAddr) bool {
+	speed, reason := task.CheckDownloadSpeed(ip, conf.SpeedCheckTimeout, conf.SpeedCheckBytes)
+	if reason != "" { // 证书或内容校验失败，无论速度如何均不可用
+		utils.LogInfo("IP [%s] 不可用: %s", ip.String(), reason)
+		return false
+	}
+	if speed <= 0 || speed < conf.SpeedThreshold*1024*1024 {
+		utils.LogInfo("IP [%s] 下载速度 %.2f MB/s 低于阈值 %.2f MB/s", ip.String(), speed/1024/1024, conf.SpeedThreshold)
+		return false
+	}
+	if utils.Debug { // 调试模式下，输出更多信息
+		utils.LogDebug("IP [%s] 下载速度 %.2f MB/s", ip.String(), speed/1024/1024)
+	}
+	return true
+}
+
+// measureIPs 按常规的测速条件对指定 IP 重新进行延迟测速及下载测速
+func measureIPs(ips []string) utils.DownloadSpeedSet {
+	if len(ips) == 0 {
+		return nil
+	}
+
+	// 保存原始设置（下载测速会根据队列长度修改下载测速数量）
+	origIPText := task.IPText
+	origTestCount := task.TestCount
+
+	task.IPText = strings.Join(ips, ",")
+	speedData := task.TestUploadSpeed(task.TestDownloadSpeed(task.NewPing().Run().FilterDelay().FilterLossRate().FilterTLS().FilterStats()))
+
+	// 恢复原始设置
+	task.IPText = origIPText
+	task.TestCount = origTestCount
+
+	return speedData
+}
+
+// replaceDegraded 保留健康的 IP，并按排名从候补 IP 中依次挑选并重新检查，替换失效的 IP
+// 同一地址族的候补 IP 不足以替换失效的 IP 时返回 false
+func (p *ipPool) replaceDegraded(healthy map[string]*utils.PingData) bool {
+	var kept utils.DownloadSpeedSet
+	need := make(map[bool]int) // 按地址族（是否为 IPv4）统计需要替换的数量
+	for _, data := range p.published {
+		if pingData, ok := healthy[data.IP.String()]; ok {
+			kept = append(kept, utils.CloudflareIPData{PingData: pingData, DownloadSpeed: data.DownloadSpeed})
+		} else {
+			need[task.IsIPv4(data.IP.String())]++
+		}
+	}
+
+	for need[true] > 0 || need[false] > 0 {
+		// 按排名为每个地址族挑选与缺口数量相同的候补 IP
+		var batch []string
+		var rest utils.DownloadSpeedSet
+		picked := make(map[bool]int)
+		candidates := make(map[string]utils.CloudflareIPData)
+		for _, data := range p.reserve {
+			ip := data.IP.String()
+			isIPv4 := task.IsIPv4(ip)
+			if picked[isIPv4] < need[isIPv4] {
+				picked[isIPv4]++
+				batch = append(batch, ip)
+				candidates[ip] = data
+			} else {
+				rest = append(rest, data)
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+		p.reserve = rest // 检查过的候补 IP 无论结果如何都从候补中移除
+
+		utils.LogInfo("正在检查 %d 个候补 IP...", len(batch))
+		checked := healthCheck(batch)
+		for _, ip := range batch { // 按原有排名提升通过检查的候补 IP
+			pingData, ok := checked[ip]
+			if !ok {
+				continue
+			}
+			isIPv4 := task.IsIPv4(ip)
+			kept = append(kept, utils.CloudflareIPData{PingData: pingData, DownloadSpeed: candidates[ip].DownloadSpeed})
+			need[isIPv4]--
+			utils.LogInfo("候补 IP [%s] 通过检查，替换失效的 IP", ip)
+		}
+	}
+
+	if need[true] > 0 || need[false] > 0 {
+		return false
+	}
+	sortByRank(kept)
+	p.published = kept
+	return true
+}
+
+// sync 将 IP 池中已发布的 IP 同步到 DNS
+// 同时测试 IPv4 和 IPv6 时与完整测速一样分地址族同步，否则一次同步全部 IP，
+// 避免更新策略及变动通知只保留其中一个地址族的记录
+func (p *ipPool) sync() {
+	if !task.IsBothMode() {
+		ddnsSync(p.published)
+		return
+	}
+	var ipv4Data, ipv6Data utils.DownloadSpeedSet
+	for _, data := range p.published {
+		if task.IsIPv4(data.IP.String()) {
+			ipv4Data = append(ipv4Data, data)
+		} else {
+			ipv6Data = append(ipv6Data, data)
+		}
+	}
+	ddnsSync(ipv4Data)
+	ddnsSync(ipv6Data)
+}
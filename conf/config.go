@@ -7,6 +7,8 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/Lyxot/CloudflareSpeedTestDNS/ddns"
+	"github.com/Lyxot/CloudflareSpeedTestDNS/notify"
+	"github.com/Lyxot/CloudflareSpeedTestDNS/schedule"
 	"github.com/Lyxot/CloudflareSpeedTestDNS/task"
 	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
 )
@@ -17,12 +19,25 @@ var (
 	EnableCFKV        bool
 	EnableDNSPod      bool
 	EnableCron        bool
+	EnablePolicy      bool
 	LatencyThreshold  time.Duration
 	LossRateThreshold float32
 	CheckInterval     time.Duration
 	TestInterval      time.Duration
+	CheckSchedule     schedule.Schedule
+	TestSchedule      schedule.Schedule
+	QuietHours        *schedule.Windows
+	Incremental       bool
+	SpeedCheck        bool
+	SpeedThreshold    float64
+	SpeedCheckTimeout time.Duration
+	SpeedCheckBytes   int64
 	MinNum            int
 	MaxAttempts       int
+
+	PolicyDelayMargin   time.Duration
+	PolicyMarginPercent float64
+	PolicyMinDwell      time.Duration
 )
 
 // Config 配置文件结构体
@@ -34,33 +49,83 @@ type Config struct {
 	MaxDelay    int     `toml:"max_delay"`     // 平均延迟上限
 	MinDelay    int     `toml:"min_delay"`     // 平均延迟下限
 	MaxLossRate float64 `toml:"max_loss_rate"` // 丢包几率上限
+	Icmping     bool    `toml:"icmping"`       // 切换测速模式为ICMP
+	MaxJitter   int     `toml:"max_jitter"`    // 抖动上限
+	MaxP95      int     `toml:"max_p95"`       // P95延迟上限
+	SortBy      string  `toml:"sort_by"`       // 延迟排序依据
+
+	// 自适应测速相关
+	AdaptivePing   bool    `toml:"adaptive_ping"`    // 自适应测速次数
+	MaxFailures    int     `toml:"max_failures"`     // 连续失败次数上限
+	ExtraPingTimes int     `toml:"extra_ping_times"` // 额外测速次数
+	AdaptiveMargin float64 `toml:"adaptive_margin"`  // 接近延迟上限的比例
 
 	// HTTP测速相关
 	Httping     bool   `toml:"httping"`      // 切换测速模式为HTTP
 	HttpingCode int    `toml:"httping_code"` // 有效状态代码
+	Http3       bool   `toml:"http3"`        // 使用HTTP/3(QUIC)进行HTTP测速及下载测速
 	Cfcolo      string `toml:"cfcolo"`       // 匹配指定地区
+	ColoLookup  bool   `toml:"colo_lookup"`  // TCP及ICMP测速模式下获取地区码
+
+	// 请求相关（HTTP、TLS测速及下载测速共用）
+	HttpingMethod string `toml:"httping_method"` // HTTP测速使用的请求方法
+	HttpHeaders   string `toml:"http_headers"`   // 自定义请求头
+	HttpHost      string `toml:"http_host"`      // 请求使用的Host
+
+	// TLS测速相关
+	Tlsping    bool   `toml:"tlsping"`      // 切换测速模式为TLS
+	TlsSni     string `toml:"tls_sni"`      // TLS握手使用的SNI（HTTP测速及下载测速共用）
+	MaxTlsTime int    `toml:"max_tls_time"` // TLS握手耗时上限
+	MaxTtfb    int    `toml:"max_ttfb"`     // 首字节耗时上限
 
 	// 下载测速相关
-	TestCount       int     `toml:"test_count"`       // 下载测速数量
-	DownloadTime    int     `toml:"download_time"`    // 下载测速时间
-	Url             string  `toml:"url"`              // 指定测速地址
-	MinSpeed        float64 `toml:"min_speed"`        // 下载速度下限
-	DisableDownload bool    `toml:"disable_download"` // 禁用下载测速
+	TestCount         int     `toml:"test_count"`          // 下载测速数量
+	DownloadTime      int     `toml:"download_time"`       // 下载测速时间
+	Url               string  `toml:"url"`                 // 指定测速地址
+	MinSpeed          float64 `toml:"min_speed"`           // 下载速度下限
+	DisableDownload   bool    `toml:"disable_download"`    // 禁用下载测速
+	DownloadRoutines  int     `toml:"download_routines"`   // 同时下载测速的IP数量
+	DownloadStartRate float64 `toml:"download_start_rate"` // 开始测速下一个IP的总下载速度阈值
+	DownloadMaxRate   float64 `toml:"download_max_rate"`   // 下载测速的总下载速度上限
+	VerifyTls         bool    `toml:"verify_tls"`          // 下载测速时验证证书
+	VerifyTlsName     string  `toml:"verify_tls_name"`     // 验证证书使用的域名
+	TlsPin            string  `toml:"tls_pin"`             // 证书公钥固定
+	DownloadSha256    string  `toml:"download_sha256"`     // 下载内容的SHA-256
+	DownloadMinSize   int64   `toml:"download_min_size"`   // 至少下载的数据量
+	DownloadPrefix    string  `toml:"download_prefix"`     // 下载内容须以此开头
+	DownloadRegexp    string  `toml:"download_regexp"`     // 下载内容须匹配的正则表达式
+	UploadUrl         string  `toml:"upload_url"`          // 上传测速地址
+	UploadSize        int64   `toml:"upload_size"`         // 上传数据量
+	MinUploadSpeed    float64 `toml:"min_upload_speed"`    // 上传速度下限
 
 	// 输入输出相关
-	PrintNum    int    `toml:"print_num"`    // 显示结果数量
-	MinNum      int    `toml:"min_num"`      // 最少结果数量
-	MaxAttempts int    `toml:"max_attempts"` // 最大尝试次数
-	IpFile      string `toml:"ip_file"`      // IP段数据文件
-	Ipv4File    string `toml:"ipv4_file"`    // IPv4段数据文件
-	Ipv6File    string `toml:"ipv6_file"`    // IPv6段数据文件
-	IpText      string `toml:"ip_text"`      // 指定IP段数据
-	Output      string `toml:"output"`       // 输出结果文件
-	LogFile     string `toml:"log_file"`     // 日志文件
+	PrintNum      int    `toml:"print_num"`      // 显示结果数量
+	MinNum        int    `toml:"min_num"`        // 最少结果数量
+	MaxAttempts   int    `toml:"max_attempts"`   // 最大尝试次数
+	IpFile        string `toml:"ip_file"`        // IP段数据文件
+	Ipv4File      string `toml:"ipv4_file"`      // IPv4段数据文件
+	Ipv6File      string `toml:"ipv6_file"`      // IPv6段数据文件
+	IpText        string `toml:"ip_text"`        // 指定IP段数据
+	IpCacheDir    string `toml:"ip_cache_dir"`   // 远程IP段数据缓存目录
+	IpSource      string `toml:"ip_source"`      // IP段数据来源，指定后ip_file无效
+	PresetRefresh bool   `toml:"preset_refresh"` // 从CDN官方接口更新内置IP段数据
+	ExcludeFile   string `toml:"exclude_file"`   // 排除的IP段数据文件
+	ExcludeText   string `toml:"exclude_text"`   // 排除的IP段数据
+	Output        string `toml:"output"`         // 输出结果文件
+	LogFile       string `toml:"log_file"`       // 日志文件
 
 	// 其他选项
-	TestAll bool `toml:"test_all"` // 测速全部IP
-	Debug   bool `toml:"debug"`    // 调试输出模式
+	TestAll       bool `toml:"test_all"`       // 测速全部IP
+	RefineSearch  bool `toml:"refine_search"`  // 两阶段测速
+	RefineBlocks  int  `toml:"refine_blocks"`  // 精测网段数量
+	RefineSamples int  `toml:"refine_samples"` // 每个网段精测IP数量
+
+	// 采样相关
+	SamplesPerPrefix    int  `toml:"samples_per_prefix"`     // 每个采样前缀测速IP数量
+	Ipv4SamplePrefixLen int  `toml:"ipv4_sample_prefix_len"` // IPv4采样前缀长度
+	Ipv6SamplePrefixLen int  `toml:"ipv6_sample_prefix_len"` // IPv6采样前缀长度
+	MaxCandidates       int  `toml:"max_candidates"`         // 候选IP总数上限
+	Debug               bool `toml:"debug"`                  // 调试输出模式
 
 	// 阿里云DNS相关
 	Alidns AliDNSConfig `toml:"alidns"` // 阿里云DNS配置
@@ -76,6 +141,18 @@ type Config struct {
 
 	// Cron 定时任务相关
 	Cron CronConfig `toml:"cron"`
+
+	// DNS 更新策略相关
+	Policy PolicyConfig `toml:"policy"`
+
+	// 通知相关
+	Notify NotifyConfig `toml:"notify"`
+
+	// 综合评分排序相关
+	Rank RankConfig `toml:"rank"`
+
+	// ASN 及地理位置相关
+	Geoip GeoIPConfig `toml:"geoip"`
 }
 
 // AliDNSConfig 阿里云DNS配置
@@ -124,11 +201,88 @@ type CronConfig struct {
 	LossRateThreshold float64 `toml:"loss_rate_threshold"`
 	CheckInterval     int     `toml:"check_interval"`
 	TestInterval      int     `toml:"test_interval"`
+	CheckCron         string  `toml:"check_cron"`         // 检测任务 cron 表达式，指定后 check_interval 无效
+	TestCron          string  `toml:"test_cron"`          // 强制刷新任务 cron 表达式，指定后 test_interval 无效
+	Timezone          string  `toml:"timezone"`           // cron 表达式与静默时段使用的时区
+	QuietHours        string  `toml:"quiet_hours"`        // 静默时段，期间不进行完整测速
+	Incremental       bool    `toml:"incremental"`        // 增量检查，仅替换失效的 IP
+	SpeedCheck        bool    `toml:"speed_check"`        // 检测时对 IP 进行轻量下载测速
+	SpeedThreshold    float64 `toml:"speed_threshold"`    // 下载速度阈值 (MB/s)
+	SpeedCheckTime    int     `toml:"speed_check_time"`   // 单个 IP 的下载时间上限（秒）
+	SpeedCheckSize    int     `toml:"speed_check_size"`   // 单个 IP 的下载数据量上限（MB）
+	BlacklistDuration int     `toml:"blacklist_duration"` // 检查失败的 IP 临时拉黑的时长（分钟）
+}
+
+// PolicyConfig DNS 更新策略相关参数
+type PolicyConfig struct {
+	Enable        bool    `toml:"enable"`         // 是否启用更新策略
+	DelayMargin   int     `toml:"delay_margin"`   // 候选 IP 的延迟需至少低多少毫秒才替换已发布的 IP
+	MarginPercent float64 `toml:"margin_percent"` // 候选 IP 的排名指标需至少好多少百分比才替换已发布的 IP
+	MinDwell      int     `toml:"min_dwell"`      // 已发布 IP 的最短保留时间（分钟）
+}
+
+// RankConfig 综合评分排序相关参数
+type RankConfig struct {
+	Enable        bool    `toml:"enable"`         // 是否按综合评分排序
+	SpeedWeight   float64 `toml:"speed_weight"`   // 下载速度(MB/s)权重
+	DelayWeight   float64 `toml:"delay_weight"`   // 平均延迟(ms)权重
+	LossPenalty   float64 `toml:"loss_penalty"`   // 丢包率(0~1)惩罚
+	JitterPenalty float64 `toml:"jitter_penalty"` // 抖动(ms)惩罚
+	Expression    string  `toml:"expression"`     // 自定义评分表达式，指定后权重参数无效
+}
+
+// GeoIPConfig ASN 及地理位置相关参数
+type GeoIPConfig struct {
+	CityDB  string `toml:"city_db"` // 城市（或国家）MMDB 数据库路径
+	AsnDB   string `toml:"asn_db"`  // ASN MMDB 数据库路径
+	Asn     string `toml:"asn"`     // 只测速属于指定 ASN 的 IP，英文逗号分隔
+	Country string `toml:"country"` // 只测速属于指定国家的 IP，英文逗号分隔
+}
+
+// NotifyConfig 通知相关参数
+type NotifyConfig struct {
+	TitleTemplate   string         `toml:"title_template"`   // 通知标题模板，为空时使用默认模板
+	ContentTemplate string         `toml:"content_template"` // 通知内容模板，为空时使用默认模板
+	Webhook         WebhookConfig  `toml:"webhook"`          // 通用 JSON Webhook 配置
+	Telegram        TelegramConfig `toml:"telegram"`         // Telegram Bot 配置
+	Push            PushConfig     `toml:"push"`             // Bark、Server酱等推送服务配置
+	SMTP            SMTPConfig     `toml:"smtp"`             // SMTP 邮件配置
+}
+
+// WebhookConfig 通用 JSON Webhook 配置
+type WebhookConfig struct {
+	Enable bool   `toml:"enable"` // 是否启用 Webhook 通知
+	URL    string `toml:"url"`    // Webhook 地址
+}
+
+// TelegramConfig Telegram Bot 配置
+type TelegramConfig struct {
+	Enable   bool   `toml:"enable"`    // 是否启用 Telegram 通知
+	BotToken string `toml:"bot_token"` // Telegram Bot Token
+	ChatID   string `toml:"chat_id"`   // 接收通知的 Chat ID
+	ApiURL   string `toml:"api_url"`   // Telegram Bot API 地址
+}
+
+// PushConfig Bark、Server酱等推送服务配置
+type PushConfig struct {
+	Enable bool   `toml:"enable"` // 是否启用推送通知
+	URL    string `toml:"url"`    // 推送地址，支持 {title} 和 {content} 占位符
+}
+
+// SMTPConfig SMTP 邮件配置
+type SMTPConfig struct {
+	Enable   bool   `toml:"enable"`   // 是否启用邮件通知
+	Host     string `toml:"host"`     // SMTP 服务器地址
+	Port     int    `toml:"port"`     // SMTP 服务器端口
+	Username string `toml:"username"` // SMTP 用户名
+	Password string `toml:"password"` // SMTP 密码或授权码
+	From     string `toml:"from"`     // 发件人
+	To       string `toml:"to"`       // 收件人，多个收件人英文逗号分隔
 }
 
-// LoadConfig 从TOML文件加载配置
+// LoadConfig 从TOML文件加载配置，配置文件中未设置的参数使用 CreateDefaultConfig 中的默认值
 func LoadConfig(path string) (*Config, error) {
-	config := &Config{}
+	config := CreateDefaultConfig()
 
 	// 检查文件是否存在
 	_, err := os.Stat(path)
@@ -148,30 +302,72 @@ func LoadConfig(path string) (*Config, error) {
 // CreateDefaultConfig 创建默认配置
 func CreateDefaultConfig() *Config {
 	return &Config{
-		Routines:        200,
-		PingTimes:       4,
-		TcpPort:         443,
-		MaxDelay:        9999,
-		MinDelay:        0,
-		MaxLossRate:     1.0,
-		Httping:         false,
-		HttpingCode:     0,
-		Cfcolo:          "",
-		TestCount:       10,
-		DownloadTime:    10,
-		Url:             "https://cf.xiu2.xyz/url",
-		MinSpeed:        0.0,
-		DisableDownload: false,
-		PrintNum:        10,
-		MinNum:          0,
-		MaxAttempts:     10,
-		IpFile:          "ip.txt",
-		Ipv4File:        "",
-		Ipv6File:        "",
-		IpText:          "",
-		Output:          "result.csv",
-		LogFile:         "",
-		TestAll:         false,
+		Routines:            200,
+		PingTimes:           4,
+		TcpPort:             443,
+		MaxDelay:            9999,
+		MinDelay:            0,
+		MaxLossRate:         1.0,
+		Icmping:             false,
+		MaxJitter:           0,
+		MaxP95:              0,
+		SortBy:              "avg",
+		AdaptivePing:        false,
+		MaxFailures:         2,
+		ExtraPingTimes:      4,
+		AdaptiveMargin:      0.2,
+		Httping:             false,
+		HttpingCode:         0,
+		Http3:               false,
+		Cfcolo:              "",
+		ColoLookup:          true,
+		HttpingMethod:       "HEAD",
+		HttpHeaders:         "",
+		HttpHost:            "",
+		Tlsping:             false,
+		TlsSni:              "",
+		MaxTlsTime:          0,
+		MaxTtfb:             0,
+		TestCount:           10,
+		DownloadTime:        10,
+		Url:                 "https://cf.xiu2.xyz/url",
+		MinSpeed:            0.0,
+		DisableDownload:     false,
+		DownloadRoutines:    1,
+		DownloadStartRate:   0,
+		DownloadMaxRate:     0,
+		VerifyTls:           false,
+		VerifyTlsName:       "",
+		TlsPin:              "",
+		DownloadSha256:      "",
+		DownloadMinSize:     0,
+		DownloadPrefix:      "",
+		DownloadRegexp:      "",
+		UploadUrl:           "",
+		UploadSize:          10,
+		MinUploadSpeed:      0.0,
+		PrintNum:            10,
+		MinNum:              0,
+		MaxAttempts:         10,
+		IpFile:              "ip.txt",
+		Ipv4File:            "",
+		Ipv6File:            "",
+		IpText:              "",
+		IpCacheDir:          "ip_cache",
+		IpSource:            "",
+		PresetRefresh:       false,
+		ExcludeFile:         "",
+		ExcludeText:         "",
+		Output:              "result.csv",
+		LogFile:             "",
+		TestAll:             false,
+		RefineSearch:        false,
+		RefineBlocks:        5,
+		RefineSamples:       0,
+		SamplesPerPrefix:    1,
+		Ipv4SamplePrefixLen: 24,
+		Ipv6SamplePrefixLen: 0,
+		MaxCandidates:       0,
 		Alidns: AliDNSConfig{
 			Enable: false,
 			TTL:    600,
@@ -194,6 +390,41 @@ func CreateDefaultConfig() *Config {
 			LossRateThreshold: 1.0,
 			CheckInterval:     30,
 			TestInterval:      24,
+			SpeedCheck:        false,
+			SpeedThreshold:    0,
+			SpeedCheckTime:    3,
+			SpeedCheckSize:    10,
+			BlacklistDuration: 0,
+		},
+		Policy: PolicyConfig{
+			Enable:        false,
+			DelayMargin:   0,
+			MarginPercent: 0,
+			MinDwell:      0,
+		},
+		Rank: RankConfig{
+			Enable:        false,
+			SpeedWeight:   1,
+			DelayWeight:   0,
+			LossPenalty:   0,
+			JitterPenalty: 0,
+			Expression:    "",
+		},
+		Geoip: GeoIPConfig{
+			CityDB:  "",
+			AsnDB:   "",
+			Asn:     "",
+			Country: "",
+		},
+		Notify: NotifyConfig{
+			Telegram: TelegramConfig{
+				Enable: false,
+				ApiURL: "https://api.telegram.org",
+			},
+			SMTP: SMTPConfig{
+				Enable: false,
+				Port:   465,
+			},
 		},
 	}
 }
@@ -213,8 +444,43 @@ func ApplyConfig(config *Config) {
 		task.TCPPort = config.TcpPort
 	}
 
+	task.ICMPing = config.Icmping
+
+	// 设置自适应测速相关参数
+	task.AdaptivePing = config.AdaptivePing
+	if config.MaxFailures > 0 {
+		task.MaxFailures = config.MaxFailures
+	}
+	if config.ExtraPingTimes >= 0 {
+		task.ExtraPingTimes = config.ExtraPingTimes
+	}
+	if config.AdaptiveMargin > 0 {
+		task.AdaptiveMargin = config.AdaptiveMargin
+	}
+
 	// 设置HTTP测速相关参数
 	task.Httping = config.Httping
+	task.HTTP3 = config.Http3
+
+	// 设置TLS测速相关参数
+	task.TLSPing = config.Tlsping
+	task.TLSSNI = config.TlsSni
+	if config.MaxTlsTime > 0 {
+		utils.InputMaxTLSTime = time.Duration(config.MaxTlsTime) * time.Millisecond
+	}
+	if config.MaxTtfb > 0 {
+		utils.InputMaxTTFB = time.Duration(config.MaxTtfb) * time.Millisecond
+	}
+
+	// 同时启用多种测速模式时，按 HTTP、TLS、ICMP 的顺序选择
+	if task.Httping && (task.TLSPing || task.ICMPing) {
+		utils.LogWarn("同时启用了多种延迟测速模式，将使用 HTTP 测速模式")
+		task.TLSPing, task.ICMPing = false, false
+	} else if task.TLSPing && task.ICMPing {
+		utils.LogWarn("同时启用了多种延迟测速模式，将使用 TLS 测速模式")
+		task.ICMPing = false
+	}
+	utils.TLSPhases = task.TLSPing
 
 	if config.HttpingCode > 0 {
 		task.HttpingStatusCode = config.HttpingCode
@@ -224,6 +490,10 @@ func ApplyConfig(config *Config) {
 		task.HttpingCFColo = config.Cfcolo
 		task.HttpingCFColoMap = task.MapColoMap()
 	}
+	task.ColoLookup = config.ColoLookup
+	task.HttpingMethod = task.CheckHttpingMethod(config.HttpingMethod)
+	task.HTTPHeaders = task.ParseHTTPHeaders(config.HttpHeaders)
+	task.HTTPHost = config.HttpHost
 
 	// 设置下载测速相关参数
 	if config.TestCount > 0 {
@@ -243,12 +513,47 @@ func ApplyConfig(config *Config) {
 	}
 
 	task.Disable = config.DisableDownload
+	if config.DownloadRoutines > 0 {
+		task.DownloadRoutines = config.DownloadRoutines
+	}
+	if config.DownloadStartRate >= 0 {
+		task.DownloadStartRate = config.DownloadStartRate
+	}
+	if config.DownloadMaxRate >= 0 {
+		task.DownloadMaxRate = config.DownloadMaxRate
+	}
+	task.VerifyTLS = config.VerifyTls
+	task.VerifyTLSName = config.VerifyTlsName
+	task.TLSPins = task.ParseTLSPins(config.TlsPin)
+	if len(task.TLSPins) > 0 && !task.VerifyTLS {
+		utils.LogWarn("指定了 tls_pin 但未开启 verify_tls，证书公钥固定不会生效")
+	}
+	task.DownloadSHA256 = task.ParseDownloadSHA256(config.DownloadSha256)
+	task.DownloadMinBytes = config.DownloadMinSize
+	task.DownloadPrefix = config.DownloadPrefix
+	task.DownloadRegexp = task.ParseDownloadRegexp(config.DownloadRegexp)
+	if task.DownloadSHA256 != "" && task.DownloadMinBytes <= 0 && task.DownloadPrefix == "" && task.DownloadRegexp == nil {
+		utils.LogWarn("只指定了 download_sha256 时，下载测速时间内未下载完整的 IP 会被判定为不可用，请确保 url 能在 download_time 内下载完")
+	}
+	task.UploadURL = config.UploadUrl
+	if config.UploadSize > 0 {
+		task.UploadSize = config.UploadSize
+	}
+	if config.MinUploadSpeed >= 0 {
+		task.MinUploadSpeed = config.MinUploadSpeed
+	}
+	utils.UploadColumns = task.UploadURL != ""
 
 	// 设置输入输出相关参数
 	if config.IpFile != "" {
 		task.IPFile = config.IpFile
 	}
 
+	if config.IpSource != "" {
+		task.IPFile = config.IpSource
+	}
+	task.PresetRefresh = config.PresetRefresh
+
 	if config.Ipv4File != "" {
 		task.IPv4File = config.Ipv4File
 	}
@@ -257,6 +562,10 @@ func ApplyConfig(config *Config) {
 		task.IPv6File = config.Ipv6File
 	}
 
+	task.IPCacheDir = config.IpCacheDir
+	task.ExcludeFile = config.ExcludeFile
+	task.ExcludeText = config.ExcludeText
+
 	if config.IpText != "" {
 		task.IPText = config.IpText
 	}
@@ -269,6 +578,27 @@ func ApplyConfig(config *Config) {
 
 	// 设置其他选项
 	task.TestAll = config.TestAll
+	task.RefineSearch = config.RefineSearch
+	if config.RefineBlocks > 0 {
+		task.RefineBlocks = config.RefineBlocks
+	}
+	if config.RefineSamples >= 0 {
+		task.RefineSamples = config.RefineSamples
+	}
+
+	// 设置采样相关参数
+	if config.SamplesPerPrefix > 0 {
+		task.SamplesPerPrefix = config.SamplesPerPrefix
+	}
+	if config.Ipv4SamplePrefixLen > 0 && config.Ipv4SamplePrefixLen <= 32 {
+		task.IPv4SamplePrefixLen = config.Ipv4SamplePrefixLen
+	}
+	if config.Ipv6SamplePrefixLen >= 0 && config.Ipv6SamplePrefixLen <= 128 {
+		task.IPv6SamplePrefixLen = config.Ipv6SamplePrefixLen
+	}
+	if config.MaxCandidates >= 0 {
+		task.MaxCandidates = config.MaxCandidates
+	}
 	utils.Debug = config.Debug
 
 	// 设置阿里云DNS相关参数
@@ -302,6 +632,30 @@ func ApplyConfig(config *Config) {
 	ddns.CloudflareKVConfig.AccountID = config.Cfkv.AccountID
 	ddns.CloudflareKVConfig.NamespaceID = config.Cfkv.NamespaceID
 
+	// 设置通知相关参数
+	notify.WebhookConfig.Enable = config.Notify.Webhook.Enable
+	notify.WebhookConfig.URL = config.Notify.Webhook.URL
+	notify.TelegramConfig.Enable = config.Notify.Telegram.Enable
+	notify.TelegramConfig.BotToken = config.Notify.Telegram.BotToken
+	notify.TelegramConfig.ChatID = config.Notify.Telegram.ChatID
+	if config.Notify.Telegram.ApiURL != "" {
+		notify.TelegramConfig.APIURL = config.Notify.Telegram.ApiURL
+	}
+	notify.PushConfig.Enable = config.Notify.Push.Enable
+	notify.PushConfig.URL = config.Notify.Push.URL
+	notify.SMTPConfig.Enable = config.Notify.SMTP.Enable
+	notify.SMTPConfig.Host = config.Notify.SMTP.Host
+	if config.Notify.SMTP.Port > 0 {
+		notify.SMTPConfig.Port = config.Notify.SMTP.Port
+	}
+	notify.SMTPConfig.Username = config.Notify.SMTP.Username
+	notify.SMTPConfig.Password = config.Notify.SMTP.Password
+	notify.SMTPConfig.From = config.Notify.SMTP.From
+	notify.SMTPConfig.To = config.Notify.SMTP.To
+	if err := notify.SetTemplates(config.Notify.TitleTemplate, config.Notify.ContentTemplate); err != nil {
+		utils.LogFatal("通知配置错误: %v", err)
+	}
+
 	// 设置输入输出相关参数
 	if config.PrintNum >= 0 {
 		utils.PrintNum = config.PrintNum
@@ -336,6 +690,52 @@ func ApplyConfig(config *Config) {
 		utils.InputMaxLossRate = float32(config.MaxLossRate)
 	}
 
+	if config.MaxJitter > 0 {
+		utils.InputMaxJitter = time.Duration(config.MaxJitter) * time.Millisecond
+	}
+
+	if config.MaxP95 > 0 {
+		utils.InputMaxP95 = time.Duration(config.MaxP95) * time.Millisecond
+	}
+
+	switch config.SortBy {
+	case "":
+	case utils.SortByAverage, utils.SortByMedian, utils.SortByP95, utils.SortByMax, utils.SortByJitter:
+		utils.SortBy = config.SortBy
+	default:
+		utils.LogWarn("无效的延迟排序依据 [%s]，改用平均延迟排序", config.SortBy)
+	}
+
+	// 设置综合评分排序相关参数
+	if config.Rank.Enable {
+		if config.Rank.Expression != "" {
+			if err := utils.SetScoreExpression(config.Rank.Expression); err != nil {
+				utils.LogFatal("综合评分配置错误: %v", err)
+			}
+		} else {
+			utils.SetWeightedScore(config.Rank.SpeedWeight, config.Rank.DelayWeight, config.Rank.LossPenalty, config.Rank.JitterPenalty)
+		}
+	}
+
+	// 设置ASN及地理位置相关参数
+	task.GeoCityDB = config.Geoip.CityDB
+	task.GeoASNDB = config.Geoip.AsnDB
+	task.GeoASNFilter = config.Geoip.Asn
+	task.GeoCountryFilter = config.Geoip.Country
+	utils.GeoColumns = task.GeoEnabled()
+
+	// 设置DNS更新策略相关参数
+	EnablePolicy = config.Policy.Enable
+	if config.Policy.DelayMargin > 0 {
+		PolicyDelayMargin = time.Duration(config.Policy.DelayMargin) * time.Millisecond
+	}
+	if config.Policy.MarginPercent > 0 {
+		PolicyMarginPercent = config.Policy.MarginPercent
+	}
+	if config.Policy.MinDwell > 0 {
+		PolicyMinDwell = time.Duration(config.Policy.MinDwell) * time.Minute
+	}
+
 	// 设置Cron定时任务相关参数
 	if config.Cron.Enable {
 		EnableCron = true
@@ -351,5 +751,63 @@ func ApplyConfig(config *Config) {
 		if config.Cron.TestInterval > 0 {
 			TestInterval = time.Duration(config.Cron.TestInterval) * time.Hour
 		}
+		Incremental = config.Cron.Incremental
+		if config.Cron.BlacklistDuration > 0 {
+			task.BlacklistDuration = time.Duration(config.Cron.BlacklistDuration) * time.Minute
+		}
+		applyCronSpeedCheck(config.Cron)
+		applyCronSchedule(config.Cron)
+	}
+}
+
+// applyCronSpeedCheck 设置定时任务检测时的轻量下载测速参数
+func applyCronSpeedCheck(config CronConfig) {
+	SpeedCheck = config.SpeedCheck
+	if config.SpeedThreshold >= 0 {
+		SpeedThreshold = config.SpeedThreshold
+	}
+
+	// 未配置时使用默认值，与 CreateDefaultConfig 保持一致
+	SpeedCheckTimeout = 3 * time.Second
+	if config.SpeedCheckTime > 0 {
+		SpeedCheckTimeout = time.Duration(config.SpeedCheckTime) * time.Second
+	}
+	SpeedCheckBytes = 10 * 1024 * 1024
+	if config.SpeedCheckSize > 0 {
+		SpeedCheckBytes = int64(config.SpeedCheckSize) * 1024 * 1024
+	}
+}
+
+// applyCronSchedule 解析定时任务的时间表及静默时段
+func applyCronSchedule(config CronConfig) {
+	location, err := schedule.LoadLocation(config.Timezone)
+	if err != nil {
+		utils.LogFatal("定时任务配置错误: %v", err)
+	}
+
+	// 未配置间隔时使用默认值，与 CreateDefaultConfig 保持一致
+	if CheckInterval <= 0 {
+		CheckInterval = 30 * time.Minute
+	}
+	if TestInterval <= 0 {
+		TestInterval = 24 * time.Hour
+	}
+
+	CheckSchedule = schedule.Every(CheckInterval)
+	if config.CheckCron != "" {
+		if CheckSchedule, err = schedule.ParseCron(config.CheckCron, location); err != nil {
+			utils.LogFatal("定时任务配置错误: %v", err)
+		}
+	}
+
+	TestSchedule = schedule.Every(TestInterval)
+	if config.TestCron != "" {
+		if TestSchedule, err = schedule.ParseCron(config.TestCron, location); err != nil {
+			utils.LogFatal("定时任务配置错误: %v", err)
+		}
+	}
+
+	if QuietHours, err = schedule.ParseWindows(config.QuietHours, location); err != nil {
+		utils.LogFatal("定时任务配置错误: %v", err)
 	}
 }
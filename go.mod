@@ -9,8 +9,12 @@ require (
 	github.com/cheggaaa/pb/v3 v3.1.7
 	github.com/cloudflare/cloudflare-go v0.115.0
 	github.com/fatih/color v1.18.0
+	github.com/oschwald/maxminddb-golang v1.13.1
+	github.com/quic-go/quic-go v0.59.0
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common v1.1.19
 	github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod v1.1.10
+	golang.org/x/net v0.43.0
 )
 
 require (
@@ -25,8 +29,9 @@ require (
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/opentracing/opentracing-go v1.2.1-0.20220228012449-10b1cf09e00b // indirect
+	github.com/quic-go/qpack v0.6.0 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
-	golang.org/x/net v0.43.0 // indirect
+	golang.org/x/crypto v0.41.0 // indirect
 	golang.org/x/sys v0.35.0 // indirect
 	golang.org/x/text v0.28.0 // indirect
 	golang.org/x/time v0.12.0 // indirect
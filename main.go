@@ -13,6 +13,7 @@ import (
 
 	"github.com/Lyxot/CloudflareSpeedTestDNS/conf"
 	"github.com/Lyxot/CloudflareSpeedTestDNS/ddns"
+	"github.com/Lyxot/CloudflareSpeedTestDNS/notify"
 	"github.com/Lyxot/CloudflareSpeedTestDNS/task"
 	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
 )
@@ -24,7 +25,7 @@ var (
 )
 
 func init() {
-	var printVersion, checkUpdateFlag, debugFlag, pgoFlag bool
+	var printVersion, checkUpdateFlag, debugFlag, pgoFlag, validateIPsFlag bool
 	var help = `CloudflareSpeedTestDNS ` + version + `-` + gitCommit + `
 测试各个 CDN 或网站所有 IP 的延迟和速度，获取最快 IP (IPv4+IPv6)！
 https://github.com/Lyxot/CloudflareSpeedTestDNS
@@ -36,6 +37,8 @@ https://github.com/Lyxot/CloudflareSpeedTestDNS
         调试输出模式；会在一些非预期情况下输出更多日志以便判断原因；(默认 关闭)
 	-pgo
 		开启 CPU 性能分析
+    -validate-ips
+        校验 IP 段数据，打印每个 IP 段的候选 IP 数量后退出
     -v
         打印程序版本
     -u
@@ -45,6 +48,7 @@ https://github.com/Lyxot/CloudflareSpeedTestDNS
 `
 	flag.BoolVar(&debugFlag, "debug", false, "调试输出模式")
 	flag.BoolVar(&pgoFlag, "pgo", false, "开启 CPU 性能分析")
+	flag.BoolVar(&validateIPsFlag, "validate-ips", false, "校验 IP 段数据")
 	flag.StringVar(&configFile, "c", "", "指定TOML配置文件")
 	flag.BoolVar(&printVersion, "v", false, "打印程序版本")
 	flag.BoolVar(&checkUpdateFlag, "u", false, "检查版本更新")
@@ -104,6 +108,15 @@ https://github.com/Lyxot/CloudflareSpeedTestDNS
 		}
 	})
 
+	if validateIPsFlag {
+		ok := task.ValidateIPs()
+		endPrint()
+		if !ok {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// 初始化日志文件
 	if err := utils.InitLogFile(); err != nil {
 		utils.LogFatal("初始化日志文件失败: %v", err)
@@ -126,53 +139,72 @@ func main() {
 
 func cron() {
 	utils.LogInfo("定时任务已启用")
-	ipData := speedTest()
+	pool := newIPPool(speedTest())
 
 	// 设置定时器
-	testTicker := time.NewTicker(conf.TestInterval)
-	checkTicker := time.NewTicker(conf.CheckInterval)
+	now := time.Now()
+	nextTest := conf.TestSchedule.Next(now)
+	nextCheck := conf.CheckSchedule.Next(now)
+	testTimer := time.NewTimer(time.Until(nextTest))
+	checkTimer := time.NewTimer(time.Until(nextCheck))
+	utils.LogInfo("下次强制刷新时间: %s，下次检查时间: %s", nextTest.Format(time.DateTime), nextCheck.Format(time.DateTime))
+
+	// 重置强制刷新定时器
+	resetTest := func(next time.Time) {
+		nextTest = next
+		testTimer.Reset(time.Until(nextTest))
+	}
+	// 完整测速，处于静默时段时推迟到静默时段结束后
+	fullTest := func() bool {
+		if next, quiet := conf.QuietHours.Postpone(time.Now(), nextTest); quiet {
+			resetTest(next) // 强制刷新定时器可能已触发，须重新设置，否则不会再次强制刷新
+			utils.LogInfo("当前处于静默时段，完整测速推迟到 %s", nextTest.Format(time.DateTime))
+			return false
+		}
+		pool = newIPPool(speedTest())
+		resetTest(conf.TestSchedule.Next(time.Now()))
+		return true
+	}
 
 	for {
 		select {
-		case <-testTicker.C:
+		case <-testTimer.C:
 			utils.LogInfo("强制刷新任务开始...")
-			ipData = speedTest()
-			checkTicker.Reset(conf.CheckInterval)
-		case <-checkTicker.C:
-			utils.LogInfo("开始检查延迟和丢包率...")
-			// 拼接 IP 段数据
-			ipText := ""
-			for _, ip := range ipData {
-				ipText += ip + ","
+			nextTest = conf.TestSchedule.Next(time.Now())
+			if fullTest() {
+				checkTimer.Reset(time.Until(conf.CheckSchedule.Next(time.Now())))
+			}
+		case <-checkTimer.C:
+			if conf.SpeedCheck {
+				utils.LogInfo("开始检查延迟、丢包率和下载速度...")
+			} else {
+				utils.LogInfo("开始检查延迟和丢包率...")
 			}
-			// 保存原始设置
-			origIPText := task.IPText
-			origMaxDelay := utils.InputMaxDelay
-			origMaxLossRate := utils.InputMaxLossRate
-
-			task.IPText = ipText
-			utils.InputMaxDelay = conf.LatencyThreshold
-			utils.InputMaxLossRate = conf.LossRateThreshold
-			pingData := task.NewPing().Run().FilterDelay().FilterLossRate()
-
-			// 恢复原始设置
-			task.IPText = origIPText
-			utils.InputMaxDelay = origMaxDelay
-			utils.InputMaxLossRate = origMaxLossRate
-
-			if len(pingData) != len(ipData) {
-				utils.LogInfo("延迟或丢包率超过阈值，开始新一轮测速...")
-				ipData = speedTest()
-				testTicker.Reset(conf.TestInterval)
+			ipData := pool.ips()
+			healthy := healthCheck(ipData)
+
+			if len(healthy) == len(ipData) {
+				utils.LogInfo("已发布的 IP 均在阈值范围内")
+			} else if !conf.Incremental {
+				utils.LogInfo("已发布的 IP 超过阈值，开始新一轮测速...")
+				fullTest()
 			} else {
-				utils.LogInfo("延迟和丢包率在阈值范围内")
+				utils.LogInfo("%d 个 IP 超过阈值，尝试使用候补 IP 替换...", len(ipData)-len(healthy))
+				if pool.replaceDegraded(healthy) {
+					pool.sync()
+				} else {
+					utils.LogInfo("候补 IP 已耗尽，开始新一轮测速...")
+					fullTest()
+				}
 			}
+			checkTimer.Reset(time.Until(conf.CheckSchedule.Next(time.Now())))
 		}
 	}
 }
 
-func speedTest() []string {
+func speedTest() ([]string, utils.DownloadSpeedSet) {
 	var ipData []string
+	var results utils.DownloadSpeedSet
 	if task.IsBothMode() {
 		// 保存原始文件设置
 		origIPv4File := task.IPv4File
@@ -184,7 +216,9 @@ func speedTest() []string {
 		task.IPv6File = ""
 		utils.Output = utils.GetFilenameWithSuffix(originOutput, "ipv4")
 		ipv4SpeedData := singleSpeedTest()                  // 开始延迟测速 + 过滤延迟/丢包
+		ipv4SpeedData = policy.apply(ipv4SpeedData)         // 应用更新策略
 		ipData = append(ipData, ddnsSync(ipv4SpeedData)...) // 同步到DNS
+		results = append(results, ipv4SpeedData...)
 
 		// 测试IPv6
 		utils.LogInfo("[IPv6] 开始测试IPv6...")
@@ -192,25 +226,30 @@ func speedTest() []string {
 		task.IPv6File = origIPv6File
 		utils.Output = utils.GetFilenameWithSuffix(originOutput, "ipv6")
 		ipv6SpeedData := singleSpeedTest()                  // 开始延迟测速 + 过滤延迟/丢包
+		ipv6SpeedData = policy.apply(ipv6SpeedData)         // 应用更新策略
 		ipData = append(ipData, ddnsSync(ipv6SpeedData)...) // 同步到DNS
+		results = append(results, ipv6SpeedData...)
 
 		// 恢复原始文件设置
 		task.IPv4File = origIPv4File
 		task.IPv6File = origIPv6File
 		utils.Output = originOutput
 	} else {
-		ipData = ddnsSync(singleSpeedTest()) // 延迟测速 + 过滤延迟/丢包 + 同步到DNS
+		results = singleSpeedTest()     // 延迟测速 + 过滤延迟/丢包
+		results = policy.apply(results) // 应用更新策略
+		ipData = ddnsSync(results)      // 同步到DNS
 	}
-	return ipData
+	return ipData, results
 }
 
 func singleSpeedTest() utils.DownloadSpeedSet {
 	var speedData utils.DownloadSpeedSet
 	for i := 0; i < conf.MaxAttempts; i++ {
-		// 开始延迟测速 + 过滤延迟/丢包
-		pingData := task.NewPing().Run().FilterDelay().FilterLossRate()
-		// 开始下载测速
-		speedData = task.TestDownloadSpeed(pingData)
+		// 开始延迟测速 + 过滤延迟/丢包/TLS耗时 + 精测最优网段
+		ping := task.NewPing()
+		pingData := ping.Refine(ping.Run().FilterDelay().FilterLossRate().FilterTLS().FilterStats())
+		// 开始下载测速 + 上传测速
+		speedData = task.TestUploadSpeed(task.TestDownloadSpeed(pingData))
 		if len(speedData) >= conf.MinNum {
 			break
 		}
@@ -221,8 +260,9 @@ func singleSpeedTest() utils.DownloadSpeedSet {
 			utils.LogWarn("符合条件的IP数量[%d]少于设定的最小数量[%d]，已达到最大重试次数，测试结束。", len(speedData), conf.MinNum)
 		}
 	}
-	utils.ExportCsv(speedData) // 输出文件
-	speedData.Print()          // 打印结果
+	task.LookupResultColos(speedData) // 为最终结果获取地区码
+	utils.ExportCsv(speedData)        // 输出文件
+	speedData.Print()                 // 打印结果
 
 	return speedData
 }
@@ -244,11 +284,14 @@ func ddnsSync(speedData utils.DownloadSpeedSet) []string {
 		}
 	}
 
+	synced := true // 是否全部同步成功
 	// 如果启用了阿里云DNS，则同步结果
 	if conf.EnableAliDNS {
 		utils.LogInfo("开始同步结果到阿里云DNS...")
 		if err := ddns.SyncDNSRecords(ipv4Results, ipv6Results); err != nil {
 			utils.LogError("同步到阿里云DNS失败: %v", err)
+			notify.NotifyError("阿里云DNS", err)
+			synced = false
 		} else {
 			utils.LogInfo("同步到阿里云DNS成功!")
 		}
@@ -259,6 +302,8 @@ func ddnsSync(speedData utils.DownloadSpeedSet) []string {
 		utils.LogInfo("开始同步结果到DNSPod DNS...")
 		if err := ddns.SyncDNSPodRecords(ipv4Results, ipv6Results); err != nil {
 			utils.LogError("同步到DNSPod DNS失败: %v", err)
+			notify.NotifyError("DNSPod DNS", err)
+			synced = false
 		} else {
 			utils.LogInfo("同步到DNSPod DNS成功!")
 		}
@@ -269,6 +314,8 @@ func ddnsSync(speedData utils.DownloadSpeedSet) []string {
 		utils.LogInfo("开始同步结果到Cloudflare DNS...")
 		if err := ddns.SyncCloudflareRecords(ipv4Results, ipv6Results); err != nil {
 			utils.LogError("同步到Cloudflare DNS失败: %v", err)
+			notify.NotifyError("Cloudflare DNS", err)
+			synced = false
 		} else {
 			utils.LogInfo("同步到Cloudflare DNS成功!")
 		}
@@ -279,12 +326,20 @@ func ddnsSync(speedData utils.DownloadSpeedSet) []string {
 		utils.LogInfo("开始同步结果到Cloudflare KV...")
 		if err := ddns.SyncCloudflareKV(speedData.FilterIPv4(), speedData.FilterIPv6()); err != nil {
 			utils.LogError("同步到Cloudflare KV失败: %v", err)
+			notify.NotifyError("Cloudflare KV", err)
+			synced = false
 		} else {
 			utils.LogInfo("同步到Cloudflare KV成功!")
 		}
 	}
 
-	return append(ipv4Results, ipv6Results...)
+	ipData := append(ipv4Results, ipv6Results...)
+	// 同步失败时 DNS 记录并未变动，不记录已发布的 IP，也不发送变动通知
+	if synced {
+		policy.record(ipData)                                           // 记录已发布的 IP
+		watcher.update(speedData[:min(utils.PrintNum, len(speedData))]) // 已发布的 IP 发生变动时发送通知
+	}
+	return ipData
 }
 
 // 根据情况选择退出方式（针对 Windows）
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/Lyxot/CloudflareSpeedTestDNS/notify"
+	"github.com/Lyxot/CloudflareSpeedTestDNS/task"
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+// publishWatcher 记录已发布的 IP 及其测速数据，在已发布的 IP 发生变动时发送通知
+type publishWatcher struct {
+	published []utils.IPData // 已发布的 IP 及其测速数据（保持发布顺序）
+}
+
+var watcher = &publishWatcher{}
+
+// update 记录本次成功同步到 DNS 的 IP，与上次发布的 IP 不同时发送变动通知（首次发布时不通知）
+func (w *publishWatcher) update(speedData utils.DownloadSpeedSet) {
+	if len(speedData) == 0 {
+		return
+	}
+	// 同时测试 IPv4 和 IPv6 时，每次只比较同一地址族的记录
+	isIPv4 := task.IsIPv4(speedData[0].IP.String())
+	var kept, old []utils.IPData
+	for _, data := range w.published {
+		if task.IsBothMode() && task.IsIPv4(data.IP) != isIPv4 {
+			kept = append(kept, data)
+		} else {
+			old = append(old, data)
+		}
+	}
+	current := append(speedData.FilterIPv4(), speedData.FilterIPv6()...)
+	w.published = append(kept, current...)
+
+	oldMap := make(map[string]bool, len(old))
+	for _, data := range old {
+		oldMap[data.IP] = true
+	}
+	currentMap := make(map[string]bool, len(current))
+	var added, removed []string
+	for _, data := range current {
+		currentMap[data.IP] = true
+		if !oldMap[data.IP] {
+			added = append(added, data.IP)
+		}
+	}
+	for _, data := range old {
+		if !currentMap[data.IP] {
+			removed = append(removed, data.IP)
+		}
+	}
+	if len(old) == 0 || (len(added) == 0 && len(removed) == 0) {
+		return
+	}
+	notify.Notify(&notify.Event{
+		Kind:    notify.EventChange,
+		Old:     old,
+		New:     current,
+		Added:   added,
+		Removed: removed,
+	})
+}
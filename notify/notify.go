@@ -0,0 +1,177 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+// EventKind 通知事件类型
+type EventKind string
+
+const (
+	EventChange EventKind = "change" // 已发布的 IP 发生变动
+	EventError  EventKind = "error"  // 同步到 DNS 服务商失败
+)
+
+// Event 通知事件，同时作为消息模板的数据
+type Event struct {
+	Kind     EventKind      `json:"kind"`               // 事件类型
+	Time     time.Time      `json:"time"`               // 事件时间
+	Provider string         `json:"provider,omitempty"` // 同步失败的 DNS 服务商
+	Error    string         `json:"error,omitempty"`    // 同步失败的错误信息
+	Old      []utils.IPData `json:"old,omitempty"`      // 变动前已发布的 IP 及其测速数据
+	New      []utils.IPData `json:"new,omitempty"`      // 变动后已发布的 IP 及其测速数据
+	Added    []string       `json:"added,omitempty"`    // 新发布的 IP
+	Removed  []string       `json:"removed,omitempty"`  // 被替换的 IP
+}
+
+// Message 根据模板渲染后的通知消息
+type Message struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	Event   *Event `json:"event"`
+}
+
+// Notifier 通知目标
+type Notifier interface {
+	Name() string                // 通知目标名称，用于日志输出
+	Enabled() bool               // 是否已启用
+	Send(message *Message) error // 发送通知
+}
+
+const (
+	defaultTitleTemplate = `CloudflareSpeedTestDNS {{if eq .Kind "error"}}同步失败{{else}}IP 变动{{end}}`
+
+	defaultContentTemplate = `{{if eq .Kind "error" -}}
+同步到 {{.Provider}} 失败: {{.Error}}
+{{- else -}}
+已发布的 IP 发生变动
+新增: {{join .Added ", "}}
+移除: {{join .Removed ", "}}
+
+当前 IP:
+{{range .New}}{{template "ip" .}}
+{{else}}无
+{{end}}
+原有 IP:
+{{range .Old}}{{template "ip" .}}
+{{else}}无
+{{end}}
+{{- end}}
+时间: {{.Time.Format "2006-01-02 15:04:05"}}`
+
+	// ipTemplate 单个 IP 的测速数据，可在自定义模板中通过 {{template "ip" .}} 引用
+	ipTemplate = `{{define "ip"}}{{.IP}} 延迟 {{.Delay}}ms 抖动 {{.Jitter}}ms 丢包率 {{printf "%.2f" .LossRate}} 速度 {{printf "%.2f" .Speed}}MB/s{{if .Upload}} 上传 {{printf "%.2f" .Upload}}MB/s{{end}}{{if .Colo}} 地区码 {{.Colo}}{{if .ColoCity}}({{.ColoCity}}){{end}}{{end}}{{if .TLSTime}} TLS 握手 {{.TLSTime}}ms 首字节 {{.TTFB}}ms{{end}}{{end}}`
+)
+
+var (
+	// httpClient 通知使用的 HTTP 客户端
+	httpClient = &http.Client{Timeout: 10 * time.Second}
+
+	// notifiers 内置的通知目标
+	notifiers = []Notifier{&WebhookConfig, &TelegramConfig, &PushConfig, &SMTPConfig}
+
+	titleTemplate   = template.Must(parseTemplate("title", defaultTitleTemplate))
+	contentTemplate = template.Must(parseTemplate("content", defaultContentTemplate))
+)
+
+// parseTemplate 解析消息模板
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl := template.New(name).Funcs(template.FuncMap{
+		"join": func(s []string, sep string) string {
+			if len(s) == 0 {
+				return "无"
+			}
+			return strings.Join(s, sep)
+		},
+	})
+	if _, err := tmpl.Parse(ipTemplate); err != nil {
+		return nil, err
+	}
+	return tmpl.Parse(text)
+}
+
+// SetTemplates 设置通知标题及内容模板，为空时使用默认模板
+func SetTemplates(title, content string) error {
+	if title != "" {
+		tmpl, err := parseTemplate("title", title)
+		if err != nil {
+			return fmt.Errorf("解析通知标题模板失败: %v", err)
+		}
+		titleTemplate = tmpl
+	}
+	if content != "" {
+		tmpl, err := parseTemplate("content", content)
+		if err != nil {
+			return fmt.Errorf("解析通知内容模板失败: %v", err)
+		}
+		contentTemplate = tmpl
+	}
+	return nil
+}
+
+// render 根据模板渲染通知消息
+func render(event *Event) (*Message, error) {
+	var title, content bytes.Buffer
+	if err := titleTemplate.Execute(&title, event); err != nil {
+		return nil, fmt.Errorf("渲染通知标题失败: %v", err)
+	}
+	if err := contentTemplate.Execute(&content, event); err != nil {
+		return nil, fmt.Errorf("渲染通知内容失败: %v", err)
+	}
+	return &Message{Title: title.String(), Content: content.String(), Event: event}, nil
+}
+
+// Enabled 是否启用了任意通知目标
+func Enabled() bool {
+	for _, n := range notifiers {
+		if n.Enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify 渲染通知消息并发送到所有已启用的通知目标，发送失败时仅输出日志
+func Notify(event *Event) {
+	if !Enabled() {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	message, err := render(event)
+	if err != nil {
+		utils.LogError("%v", err)
+		return
+	}
+	for _, n := range notifiers {
+		if !n.Enabled() {
+			continue
+		}
+		if err := n.Send(message); err != nil {
+			utils.LogError("发送%s通知失败: %v", n.Name(), err)
+		} else if utils.Debug {
+			utils.LogDebug("发送%s通知成功", n.Name())
+		}
+	}
+}
+
+// NotifyError 发送同步到 DNS 服务商失败的通知
+func NotifyError(provider string, err error) {
+	Notify(&Event{Kind: EventError, Provider: provider, Error: err.Error()})
+}
+
+// checkResponse 检查通知接口的 HTTP 响应状态码
+func checkResponse(response *http.Response) error {
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("HTTP 状态码: %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// pushConfig Bark、Server酱等推送服务配置
+type pushConfig struct {
+	Enable bool   // 是否启用推送通知
+	URL    string // 推送地址，{title} 和 {content} 会被替换为 URL 编码后的标题和内容
+}
+
+// PushConfig 默认配置
+var (
+	PushConfig = pushConfig{
+		Enable: false,
+		URL:    "",
+	}
+)
+
+func (c *pushConfig) Name() string {
+	return "推送"
+}
+
+func (c *pushConfig) Enabled() bool {
+	return c.Enable
+}
+
+// Send 将标题和内容填入推送地址后发起 GET 请求，例如：
+// Bark: https://api.day.app/<key>/{title}/{content}
+// Server酱: https://sctapi.ftqq.com/<key>.send?title={title}&desp={content}
+func (c *pushConfig) Send(message *Message) error {
+	if c.URL == "" {
+		return fmt.Errorf("推送配置不完整")
+	}
+	pushURL := strings.NewReplacer(
+		"{title}", escape(message.Title),
+		"{content}", escape(message.Content),
+	).Replace(c.URL)
+	response, err := httpClient.Get(pushURL)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+	return checkResponse(response)
+}
+
+// escape 对文本进行 URL 编码，空格编码为 %20，使其同时适用于路径和查询参数
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
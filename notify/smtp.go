@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const smtpTimeout = 30 * time.Second // 连接及发送邮件的超时时间，避免 SMTP 服务器无响应时阻塞定时任务
+
+// smtpConfig SMTP 邮件配置
+type smtpConfig struct {
+	Enable   bool   // 是否启用邮件通知
+	Host     string // SMTP 服务器地址
+	Port     int    // SMTP 服务器端口，465 时使用 SSL/TLS 连接，其他端口在服务器支持时使用 STARTTLS
+	Username string // SMTP 用户名
+	Password string // SMTP 密码或授权码
+	From     string // 发件人，为空时使用用户名
+	To       string // 收件人，多个收件人英文逗号分隔
+}
+
+// SMTPConfig 默认配置
+var (
+	SMTPConfig = smtpConfig{
+		Enable:   false,
+		Host:     "",
+		Port:     465,
+		Username: "",
+		Password: "",
+		From:     "",
+		To:       "",
+	}
+)
+
+func (c *smtpConfig) Name() string {
+	return "邮件"
+}
+
+func (c *smtpConfig) Enabled() bool {
+	return c.Enable
+}
+
+// Send 发送纯文本邮件
+func (c *smtpConfig) Send(message *Message) error {
+	from := c.From
+	if from == "" {
+		from = c.Username
+	}
+	var to []string
+	for _, addr := range strings.Split(c.To, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+	if c.Host == "" || c.Port <= 0 || from == "" || len(to) == 0 {
+		return fmt.Errorf("smtp配置不完整")
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", message.Title) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(message.Content, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	var conn net.Conn
+	var err error
+	if c.Port == 465 { // 465 端口需要先建立 TLS 连接
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: smtpTimeout}, "tcp", addr, &tls.Config{ServerName: c.Host})
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, smtpTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer func(client *smtp.Client) {
+		_ = client.Close()
+	}(client)
+	if c.Port != 465 { // 其他端口在服务器支持时使用 STARTTLS
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: c.Host}); err != nil {
+				return err
+			}
+		}
+	}
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := client.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// telegramConfig Telegram Bot 配置
+type telegramConfig struct {
+	Enable   bool   // 是否启用 Telegram 通知
+	BotToken string // Telegram Bot Token
+	ChatID   string // 接收通知的 Chat ID
+	APIURL   string // Telegram Bot API 地址，可改为反向代理地址
+}
+
+// TelegramConfig 默认配置
+var (
+	TelegramConfig = telegramConfig{
+		Enable:   false,
+		BotToken: "",
+		ChatID:   "",
+		APIURL:   "https://api.telegram.org",
+	}
+)
+
+func (c *telegramConfig) Name() string {
+	return "Telegram"
+}
+
+func (c *telegramConfig) Enabled() bool {
+	return c.Enable
+}
+
+// Send 通过 Bot API 的 sendMessage 发送通知
+func (c *telegramConfig) Send(message *Message) error {
+	if c.BotToken == "" || c.ChatID == "" {
+		return fmt.Errorf("telegram配置不完整")
+	}
+	apiURL := c.APIURL
+	if apiURL == "" {
+		apiURL = "https://api.telegram.org"
+	}
+	body, err := json.Marshal(map[string]string{
+		"chat_id": c.ChatID,
+		"text":    message.Title + "\n\n" + message.Content,
+	})
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimRight(apiURL, "/"), c.BotToken)
+	response, err := httpClient.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+	return checkResponse(response)
+}
@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// webhookConfig 通用 JSON Webhook 配置
+type webhookConfig struct {
+	Enable bool   // 是否启用 Webhook 通知
+	URL    string // Webhook 地址
+}
+
+// WebhookConfig 默认配置
+var (
+	WebhookConfig = webhookConfig{
+		Enable: false,
+		URL:    "",
+	}
+)
+
+func (c *webhookConfig) Name() string {
+	return "Webhook"
+}
+
+func (c *webhookConfig) Enabled() bool {
+	return c.Enable
+}
+
+// Send 以 JSON 格式 POST 通知标题、内容及事件数据
+func (c *webhookConfig) Send(message *Message) error {
+	if c.URL == "" {
+		return fmt.Errorf("webhook配置不完整")
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	response, err := httpClient.Post(c.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+	return checkResponse(response)
+}
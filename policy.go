@@ -0,0 +1,189 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/conf"
+	"github.com/Lyxot/CloudflareSpeedTestDNS/task"
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+// updatePolicy DNS 更新策略，避免测速结果的小幅波动导致已发布的 IP 频繁变动
+type updatePolicy struct {
+	since map[string]time.Time // 已发布的 IP 及其发布时间
+}
+
+var policy = &updatePolicy{
+	since: make(map[string]time.Time),
+}
+
+// apply 根据更新策略调整测速结果的排名：已发布的 IP 仅在候选 IP 明显更优且已超过最短保留时间时才会被替换
+// 返回结果的前 PrintNum 个即为最终要发布的 IP，其余 IP 仍按原有排名排列
+func (p *updatePolicy) apply(speedData utils.DownloadSpeedSet) utils.DownloadSpeedSet {
+	if !conf.EnablePolicy || len(speedData) == 0 || len(p.since) == 0 {
+		return speedData
+	}
+
+	// 同时测试 IPv4 和 IPv6 时，每次只处理同一地址族的已发布 IP
+	isIPv4 := task.IsIPv4(speedData[0].IP.String())
+	var incumbentIPs []string
+	for ip := range p.since {
+		if task.IsBothMode() && task.IsIPv4(ip) != isIPv4 {
+			continue
+		}
+		incumbentIPs = append(incumbentIPs, ip)
+	}
+	if len(incumbentIPs) == 0 {
+		return speedData
+	}
+
+	// 本轮测速未覆盖的已发布 IP 需要重新测速，以便在相同条件下比较
+	measured := make(map[string]bool, len(speedData))
+	for _, data := range speedData {
+		measured[data.IP.String()] = true
+	}
+	var missing []string
+	for _, ip := range incumbentIPs {
+		if !measured[ip] {
+			missing = append(missing, ip)
+		}
+	}
+	all := append(utils.DownloadSpeedSet{}, speedData...)
+	if len(missing) > 0 {
+		utils.LogInfo("正在重新测速 %d 个已发布的 IP...", len(missing))
+		all = append(all, measureIPs(missing)...)
+		sortByRank(all)
+	}
+
+	// 区分仍然可用的已发布 IP 与候选 IP（均保持排名顺序）
+	incumbentMap := make(map[string]bool, len(incumbentIPs))
+	for _, ip := range incumbentIPs {
+		incumbentMap[ip] = true
+	}
+	var kept, challengers utils.DownloadSpeedSet
+	for _, data := range all {
+		if incumbentMap[data.IP.String()] {
+			kept = append(kept, data)
+		} else {
+			challengers = append(challengers, data)
+		}
+	}
+
+	num := min(utils.PrintNum, len(all))
+	if len(kept) > num { // 已发布的 IP 多于要发布的数量时，排名靠后的 IP 重新作为候选
+		challengers = append(challengers, kept[num:]...)
+		kept = kept[:num]
+		sortByRank(challengers)
+	}
+	// 已发布的 IP 不足时，直接按排名补充候选 IP
+	for len(kept) < num && len(challengers) > 0 {
+		kept = append(kept, challengers[0])
+		challengers = challengers[1:]
+	}
+
+	// 依次用最优的候选 IP 挑战排名最差且已超过最短保留时间的已发布 IP
+	now := time.Now()
+	for len(challengers) > 0 {
+		worst := -1
+		for i := len(kept) - 1; i >= 0; i-- {
+			ip := kept[i].IP.String()
+			if since, ok := p.since[ip]; ok && now.Sub(since) < conf.PolicyMinDwell {
+				continue // 未超过最短保留时间
+			}
+			worst = i
+			break
+		}
+		if worst < 0 {
+			break
+		}
+		if !isSignificantlyBetter(challengers[0], kept[worst]) {
+			break
+		}
+		if utils.Debug {
+			utils.LogDebug("候选 IP [%s] 明显优于已发布的 IP [%s]，进行替换", challengers[0].IP.String(), kept[worst].IP.String())
+		}
+		replaced := kept[worst]
+		kept[worst] = challengers[0]
+		challengers = append(challengers[1:], replaced)
+		sortByRank(kept)
+		sortByRank(challengers)
+	}
+
+	var retained []string
+	for _, data := range kept {
+		if ip := data.IP.String(); incumbentMap[ip] {
+			retained = append(retained, ip)
+		}
+	}
+	if len(retained) > 0 {
+		utils.LogInfo("更新策略保留了已发布的 IP: %s", strings.Join(retained, ", "))
+	}
+	return append(kept, challengers...)
+}
+
+// record 记录本次同步到 DNS 的 IP，新发布的 IP 重新开始计算保留时间
+func (p *updatePolicy) record(ipData []string) {
+	if len(ipData) == 0 {
+		return
+	}
+	// 同时测试 IPv4 和 IPv6 时，每次只替换同一地址族的记录
+	isIPv4 := task.IsIPv4(ipData[0])
+	since := make(map[string]time.Time, len(p.since))
+	for ip, t := range p.since {
+		if task.IsBothMode() && task.IsIPv4(ip) != isIPv4 {
+			since[ip] = t
+		}
+	}
+	now := time.Now()
+	for _, ip := range ipData {
+		if t, ok := p.since[ip]; ok {
+			since[ip] = t
+		} else {
+			since[ip] = now
+		}
+	}
+	p.since = since
+}
+
+// isSignificantlyBetter 判断候选 IP 是否比已发布的 IP 好出配置的幅度
+func isSignificantlyBetter(challenger, incumbent utils.CloudflareIPData) bool {
+	// 首先候选 IP 的排名必须更靠前
+	if !rankedBefore(challenger, incumbent) {
+		return false
+	}
+	// 延迟需要至少低 PolicyDelayMargin
+	if conf.PolicyDelayMargin > 0 && challenger.Delay+conf.PolicyDelayMargin > incumbent.Delay {
+		return false
+	}
+	// 排名指标（下载速度，禁用下载测速时为延迟）需要至少好 PolicyMarginPercent%
+	if conf.PolicyMarginPercent > 0 {
+		ratio := conf.PolicyMarginPercent / 100
+		if task.Disable {
+			if float64(challenger.Delay) > float64(incumbent.Delay)*(1-ratio) {
+				return false
+			}
+		} else if challenger.DownloadSpeed < incumbent.DownloadSpeed*(1+ratio) {
+			return false
+		}
+	}
+	return true
+}
+
+// rankedBefore 判断 a 的排名是否在 b 之前：按下载速度（或综合评分）排序，禁用下载测速且未启用综合评分时按丢包率及延迟排序
+func rankedBefore(a, b utils.CloudflareIPData) bool {
+	if task.Disable && !utils.ScoreEnabled() {
+		return utils.PingDelaySet{a, b}.Less(0, 1)
+	}
+	return utils.DownloadSpeedSet{a, b}.Less(0, 1)
+}
+
+// sortByRank 按排名对测速结果进行稳定排序
+func sortByRank(speedData utils.DownloadSpeedSet) {
+	if task.Disable && !utils.ScoreEnabled() {
+		sort.Stable(utils.PingDelaySet(speedData))
+		return
+	}
+	sort.Stable(speedData)
+}
@@ -0,0 +1,65 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule 任务时间表，返回给定时间之后的下一次触发时间
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// cron 表达式解析器，支持 5 段（分 时 日 月 周）和 6 段（秒 分 时 日 月 周）以及 @daily 等描述符
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// cronSchedule 基于 cron 表达式的时间表，按指定时区计算触发时间
+type cronSchedule struct {
+	schedule cron.Schedule
+	location *time.Location
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	return s.schedule.Next(t.In(s.location))
+}
+
+// intervalSchedule 固定间隔的时间表
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+func (s *intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
+
+// ParseCron 解析 cron 表达式，并在指定时区中计算触发时间
+func ParseCron(spec string, location *time.Location) (Schedule, error) {
+	if location == nil {
+		location = time.Local
+	}
+	schedule, err := cronParser.Parse(strings.TrimSpace(spec))
+	if err != nil {
+		return nil, fmt.Errorf("解析 cron 表达式 [%s] 失败: %v", spec, err)
+	}
+	return &cronSchedule{schedule: schedule, location: location}, nil
+}
+
+// Every 创建固定间隔的时间表
+func Every(interval time.Duration) Schedule {
+	return &intervalSchedule{interval: interval}
+}
+
+// LoadLocation 加载时区，为空时使用本地时区
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("加载时区 [%s] 失败: %v", name, err)
+	}
+	return location, nil
+}
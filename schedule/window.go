@@ -0,0 +1,121 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// window 每日时间段，以距离当天零点的时长表示；start 大于 end 时表示跨越午夜（如 23:00-02:00）
+type window struct {
+	start time.Duration
+	end   time.Duration
+}
+
+// Windows 每日静默时间段集合
+type Windows struct {
+	windows  []window
+	location *time.Location
+}
+
+// ParseWindows 解析时间段，格式为 HH:MM-HH:MM，多个时间段以英文逗号分隔
+func ParseWindows(spec string, location *time.Location) (*Windows, error) {
+	if location == nil {
+		location = time.Local
+	}
+	w := &Windows{location: location}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, "-")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("时间段 [%s] 格式错误，应为 HH:MM-HH:MM", item)
+		}
+		start, err := parseClock(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("时间段 [%s] 格式错误: %v", item, err)
+		}
+		end, err := parseClock(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("时间段 [%s] 格式错误: %v", item, err)
+		}
+		if start == end {
+			return nil, fmt.Errorf("时间段 [%s] 的开始时间与结束时间相同", item)
+		}
+		w.windows = append(w.windows, window{start: start, end: end})
+	}
+	return w, nil
+}
+
+// parseClock 解析 HH:MM 格式的时间
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// IsEmpty 是否未配置任何时间段
+func (w *Windows) IsEmpty() bool {
+	return w == nil || len(w.windows) == 0
+}
+
+// Contains 判断指定时间是否处于任一时间段内
+func (w *Windows) Contains(t time.Time) bool {
+	_, ok := w.find(t)
+	return ok
+}
+
+// End 返回指定时间所在时间段的结束时间（相邻或重叠的时间段会被合并），不在任何时间段内时原样返回
+func (w *Windows) End(t time.Time) time.Time {
+	// 最多跨越全部时间段，避免首尾相接的配置导致死循环
+	for i := 0; i <= len(w.windows); i++ {
+		end, ok := w.find(t)
+		if !ok {
+			return t
+		}
+		t = end
+	}
+	return t
+}
+
+// Postpone 指定时间处于时间段内时，返回推迟后的执行时间：时间段结束时间与原定的下次执行时间 next 中较早的一个
+// 不在任何时间段内时返回 false，无需推迟
+func (w *Windows) Postpone(t, next time.Time) (time.Time, bool) {
+	if !w.Contains(t) {
+		return t, false
+	}
+	if end := w.End(t); end.Before(next) {
+		return end, true
+	}
+	return next, true
+}
+
+// find 查找指定时间所在的时间段，返回该时间段的结束时间
+func (w *Windows) find(t time.Time) (time.Time, bool) {
+	if w.IsEmpty() {
+		return t, false
+	}
+	t = t.In(w.location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, w.location)
+	offset := t.Sub(midnight)
+	for _, win := range w.windows {
+		if win.start < win.end {
+			if offset >= win.start && offset < win.end {
+				return midnight.Add(win.end), true
+			}
+			continue
+		}
+		// 跨越午夜的时间段
+		if offset >= win.start {
+			return midnight.AddDate(0, 0, 1).Add(win.end), true
+		}
+		if offset < win.end {
+			return midnight.Add(win.end), true
+		}
+	}
+	return t, false
+}
@@ -0,0 +1,128 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+var testLocation = time.FixedZone("UTC+8", 8*60*60)
+
+// at 返回测试时区中 2024-01-01 的指定时间，day 为相对天数
+func at(day, hour, minute int) time.Time {
+	return time.Date(2024, 1, 1+day, hour, minute, 0, 0, testLocation)
+}
+
+func TestParseWindowsInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"22:00",
+		"22:00-",
+		"-06:00",
+		"22:00-06:00-07:00",
+		"25:00-06:00",
+		"22:60-06:00",
+		"ab:cd-06:00",
+		"22-06",
+		"10:00-10:00",
+		"22:00-06:00,bad",
+	} {
+		t.Run(spec, func(t *testing.T) {
+			if _, err := ParseWindows(spec, testLocation); err == nil {
+				t.Errorf("ParseWindows(%q) error = nil, want error", spec)
+			}
+		})
+	}
+}
+
+func TestParseWindowsEmpty(t *testing.T) {
+	for _, spec := range []string{"", " ", ",", " , "} {
+		w, err := ParseWindows(spec, testLocation)
+		if err != nil {
+			t.Fatalf("ParseWindows(%q) error = %v", spec, err)
+		}
+		if !w.IsEmpty() {
+			t.Errorf("ParseWindows(%q).IsEmpty() = false, want true", spec)
+		}
+		if w.Contains(at(0, 12, 0)) {
+			t.Errorf("ParseWindows(%q).Contains() = true, want false", spec)
+		}
+	}
+	var w *Windows
+	if !w.IsEmpty() || w.Contains(at(0, 12, 0)) {
+		t.Error("nil Windows 应视为未配置时间段")
+	}
+}
+
+func TestWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		t       time.Time
+		want    bool
+		wantEnd time.Time // 不在时间段内时为原时间
+	}{
+		{"跨午夜 23:00", "22:00-06:00", at(0, 23, 0), true, at(1, 6, 0)},
+		{"跨午夜 05:59", "22:00-06:00", at(0, 5, 59), true, at(0, 6, 0)},
+		{"跨午夜 06:00", "22:00-06:00", at(0, 6, 0), false, at(0, 6, 0)},
+		{"跨午夜 22:00", "22:00-06:00", at(0, 22, 0), true, at(1, 6, 0)},
+		{"跨午夜 21:59", "22:00-06:00", at(0, 21, 59), false, at(0, 21, 59)},
+		{"跨午夜 00:00", "22:00-06:00", at(0, 0, 0), true, at(0, 6, 0)},
+		{"当天 12:30", "12:00-13:00", at(0, 12, 30), true, at(0, 13, 0)},
+		{"当天 13:00", "12:00-13:00", at(0, 13, 0), false, at(0, 13, 0)},
+		{"多个时间段", "01:00-02:00, 12:00-13:00", at(0, 12, 0), true, at(0, 13, 0)},
+		{"相邻时间段合并", "22:00-23:00,23:00-01:00", at(0, 22, 30), true, at(1, 1, 0)},
+		{"重叠时间段合并", "22:00-02:00,01:00-03:00", at(0, 23, 0), true, at(1, 3, 0)},
+		{"其他时区的时间", "22:00-06:00", at(0, 23, 0).UTC(), true, at(1, 6, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := ParseWindows(tt.spec, testLocation)
+			if err != nil {
+				t.Fatalf("ParseWindows(%q) error = %v", tt.spec, err)
+			}
+			if got := w.Contains(tt.t); got != tt.want {
+				t.Errorf("Contains(%s) = %v, want %v", tt.t, got, tt.want)
+			}
+			if got := w.End(tt.t); !got.Equal(tt.wantEnd) {
+				t.Errorf("End(%s) = %s, want %s", tt.t, got, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestWindowsEndWholeDay(t *testing.T) {
+	// 首尾相接覆盖全天的时间段不应导致死循环
+	w, err := ParseWindows("00:00-12:00,12:00-00:00", testLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end := w.End(at(0, 6, 0)); !end.After(at(0, 6, 0)) {
+		t.Errorf("End() = %s, want after %s", end, at(0, 6, 0))
+	}
+}
+
+func TestWindowsPostpone(t *testing.T) {
+	w, err := ParseWindows("22:00-06:00", testLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		now       time.Time
+		next      time.Time
+		wantTime  time.Time
+		wantQuiet bool
+	}{
+		{"不在静默时段", at(0, 12, 0), at(0, 18, 0), at(0, 12, 0), false},
+		{"推迟到静默时段结束", at(0, 23, 0), at(1, 12, 0), at(1, 6, 0), true},
+		{"原定时间更早", at(0, 23, 0), at(1, 1, 0), at(1, 1, 0), true},
+		{"静默时段结束时", at(0, 6, 0), at(0, 18, 0), at(0, 6, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, quiet := w.Postpone(tt.now, tt.next)
+			if quiet != tt.wantQuiet || !got.Equal(tt.wantTime) {
+				t.Errorf("Postpone(%s, %s) = %s, %v, want %s, %v", tt.now, tt.next, got, quiet, tt.wantTime, tt.wantQuiet)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package task
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+const (
+	defaultMaxFailures    = 2
+	defaultExtraPingTimes = 4
+	defaultAdaptiveMargin = 0.2
+)
+
+var (
+	AdaptivePing   bool                    // 自适应测速次数
+	MaxFailures    = defaultMaxFailures    // 连续失败多少次后放弃该 IP
+	ExtraPingTimes = defaultExtraPingTimes // 接近筛选条件的 IP 额外测速次数
+	AdaptiveMargin = defaultAdaptiveMargin // 平均延迟与延迟上限相差在该比例以内时视为接近筛选条件
+
+	errProbeFailed  = errors.New("测速失败")
+	errProbeAborted = errors.New("测速终止") // 无需继续测速该 IP（如地区码不匹配）
+)
+
+func checkAdaptiveDefault() {
+	if MaxFailures <= 0 {
+		MaxFailures = defaultMaxFailures
+	}
+	if ExtraPingTimes < 0 {
+		ExtraPingTimes = defaultExtraPingTimes
+	}
+	if AdaptiveMargin <= 0 {
+		AdaptiveMargin = defaultAdaptiveMargin
+	}
+}
+
+// runProbes 重复执行单次测速，返回发送次数及每次成功测速的延迟样本
+// 未启用自适应测速时固定测速 PingTimes 次；启用后连续失败 MaxFailures 次即放弃该 IP，
+// 测速 PingTimes 次后结果接近延迟或丢包条件的 IP 会额外测速 ExtraPingTimes 次
+func runProbes(probe func(seq int) (time.Duration, error)) (transmitted int, delays []time.Duration) {
+	failures := 0
+	limit := PingTimes
+	for seq := 0; seq < limit; seq++ {
+		transmitted++
+		delay, err := probe(seq)
+		if errors.Is(err, errProbeAborted) {
+			return transmitted, nil
+		}
+		if err != nil {
+			failures++
+			if AdaptivePing && failures >= MaxFailures {
+				break
+			}
+		} else {
+			failures = 0
+			delays = append(delays, delay)
+		}
+		if AdaptivePing && transmitted == PingTimes && isBorderline(transmitted, delays) {
+			limit += ExtraPingTimes
+		}
+	}
+	return
+}
+
+// isBorderline 判断测速结果是否接近延迟或丢包条件，需要更多样本才能可靠判断
+func isBorderline(transmitted int, delays []time.Duration) bool {
+	if len(delays) == 0 {
+		return false
+	}
+	// 平均延迟与延迟上限相差在 AdaptiveMargin 以内
+	if utils.InputMaxDelay > 0 && utils.InputMaxDelay < 9999*time.Millisecond {
+		var total time.Duration
+		for _, delay := range delays {
+			total += delay
+		}
+		average := float64(total / time.Duration(len(delays)))
+		if math.Abs(average-float64(utils.InputMaxDelay)) <= float64(utils.InputMaxDelay)*AdaptiveMargin {
+			return true
+		}
+	}
+	// 存在丢包，且再多（或少）一次失败就会改变丢包条件的判断结果
+	if utils.InputMaxLossRate < 1 && len(delays) < transmitted {
+		lossRate := float64(transmitted-len(delays)) / float64(transmitted)
+		step := 1 / float64(transmitted)
+		if math.Abs(lossRate-float64(utils.InputMaxLossRate)) <= step {
+			return true
+		}
+	}
+	return false
+}
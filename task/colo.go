@@ -0,0 +1,240 @@
+package task
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+const (
+	coloLookupTimeout = time.Second * 2
+	maxTraceBodySize  = 4 * 1024
+)
+
+var ColoLookup = true // 为最终结果中没有地区码的 IP（如 TCP 及 ICMP 测速模式下）额外发送一次 HTTP 请求以获取地区码
+
+// coloDetector 识别某个 CDN 并获取其地区码
+type coloDetector struct {
+	name   string
+	match  func(header http.Header) bool   // 根据响应头判断是否为该 CDN
+	header func(header http.Header) string // 从响应头中提取地区码
+	trace  string                          // 可选，返回地区码的追踪地址路径，响应头中没有地区码时访问
+	parse  func(body string) string        // 从追踪地址的响应内容中提取地区码
+}
+
+// coloDetectors 支持识别地区码的 CDN，按顺序匹配，新增 CDN 时在此添加
+var coloDetectors = []coloDetector{
+	// Cloudflare CDN
+	// server: cloudflare
+	// cf-ray: 7bd32409eda7b020-SJC
+	// /cdn-cgi/trace 返回 colo=SJC
+	{
+		name: "cloudflare",
+		match: func(header http.Header) bool {
+			return header.Get("server") == "cloudflare" || header.Get("cf-ray") != ""
+		},
+		header: func(header http.Header) string {
+			return RegexpColoIATACode.FindString(header.Get("cf-ray"))
+		},
+		trace: "/cdn-cgi/trace",
+		parse: func(body string) string {
+			for _, line := range strings.Split(body, "\n") {
+				if colo, ok := strings.CutPrefix(strings.TrimSpace(line), "colo="); ok {
+					return RegexpColoIATACode.FindString(colo)
+				}
+			}
+			return ""
+		},
+	},
+	// AWS CloudFront CDN（测试地址 https://d7uri8nf7uskq.cloudfront.net/tools/list-cloudfront-ips
+	// x-amz-cf-pop: SIN52-P1
+	{
+		name: "cloudfront",
+		match: func(header http.Header) bool {
+			return header.Get("x-amz-cf-pop") != ""
+		},
+		header: func(header http.Header) string {
+			return RegexpColoIATACode.FindString(header.Get("x-amz-cf-pop"))
+		},
+	},
+	// Fastly CDN（测试地址 https://fastly.jsdelivr.net/gh/XIU2/CloudflareSpeedTest@master/go.mod
+	// x-served-by: cache-qpg1275-QPG
+	// x-served-by: cache-fra-etou8220141-FRA, cache-hhr-khhr2060043-HHR（最后一个为实际位置）
+	{
+		name: "fastly",
+		match: func(header http.Header) bool {
+			return header.Get("x-served-by") != ""
+		},
+		header: func(header http.Header) string {
+			if matches := RegexpColoIATACode.FindAllString(header.Get("x-served-by"), -1); len(matches) > 0 {
+				return matches[len(matches)-1] // 因为 Fastly 的 x-served-by 可能包含多个地区码，所以只取最后一个
+			}
+			return ""
+		},
+	},
+	// Gcore CDN 的头部信息（注意均为城市代码而非国家代码），测试地址 https://assets.gcore.pro/assets/icons/shield-lock.svg
+	// x-id-fe: fr5-hw-edge-gc17
+	// x-shard: fr5-shard0-default
+	// x-id: fr5-hw-edge-gc28
+	{
+		name: "gcore",
+		match: func(header http.Header) bool {
+			return header.Get("x-id-fe") != ""
+		},
+		header: func(header http.Header) string {
+			return strings.ToUpper(RegexpColoCityCode.FindString(header.Get("x-id-fe"))) // 将小写的地区码转换为大写
+		},
+	},
+	// CDN77 CDN（测试地址 https://www.cdn77.com
+	// server: CDN77-Turbo
+	// x-77-pop: losangelesUSCA // 美国的会显示为 USCA 不知道什么情况，暂时没做兼容，只提取 US
+	// x-77-pop: frankfurtDE
+	{
+		name: "cdn77",
+		match: func(header http.Header) bool {
+			return header.Get("server") == "CDN77-Turbo"
+		},
+		header: func(header http.Header) string {
+			return RegexpColoCountryCode.FindString(header.Get("x-77-pop"))
+		},
+	},
+	// Bunny CDN（测试地址 https://bunny.net
+	// server: BunnyCDN-TW1-1121
+	{
+		name: "bunny",
+		match: func(header http.Header) bool {
+			return strings.HasPrefix(header.Get("server"), "BunnyCDN-")
+		},
+		header: func(header http.Header) string {
+			return RegexpColoCountryCode.FindString(strings.TrimPrefix(header.Get("server"), "BunnyCDN-")) // 去掉 BunnyCDN- 前缀再去匹配
+		},
+	},
+	// Vercel CDN
+	// server: Vercel
+	// x-vercel-id: hkg1::iad1::abcde-1234567890
+	{
+		name: "vercel",
+		match: func(header http.Header) bool {
+			return header.Get("server") == "Vercel"
+		},
+		header: func(header http.Header) string {
+			if colo := header.Get("x-vercel-id"); colo != "" {
+				return strings.ToUpper(strings.SplitN(colo, "::", 2)[0])
+			}
+			return ""
+		},
+	},
+}
+
+// matchColoDetector 返回与响应头匹配的 CDN，不是支持的 CDN 时返回 nil
+func matchColoDetector(header http.Header) *coloDetector {
+	for i := range coloDetectors {
+		if coloDetectors[i].match(header) {
+			return &coloDetectors[i]
+		}
+	}
+	return nil
+}
+
+// 从响应头中获取 地区码 值，不是支持的 CDN 时返回空字符串
+func getHeaderColo(header http.Header) string {
+	if detector := matchColoDetector(header); detector != nil {
+		return detector.header(header)
+	}
+	return ""
+}
+
+// detectColo 从响应头中获取地区码，响应头中没有地区码时通过该 CDN 的追踪地址获取
+func detectColo(hc *http.Client, ip *net.IPAddr, header http.Header) string {
+	detector := matchColoDetector(header)
+	if detector == nil {
+		return ""
+	}
+	if colo := detector.header(header); colo != "" || detector.trace == "" {
+		return colo
+	}
+	return traceColo(hc, ip, detector)
+}
+
+// traceColo 访问 CDN 的追踪地址（如 Cloudflare 的 /cdn-cgi/trace）获取地区码
+func traceColo(hc *http.Client, ip *net.IPAddr, detector *coloDetector) string {
+	target, err := url.Parse(URL)
+	if err != nil {
+		return ""
+	}
+	traceURL := url.URL{Scheme: target.Scheme, Host: target.Host, Path: detector.trace}
+	request, err := newRequest(http.MethodGet, traceURL.String())
+	if err != nil {
+		return ""
+	}
+	response, err := hc.Do(request)
+	if err != nil {
+		if utils.Debug { // 调试模式下，输出更多信息
+			utils.LogError("IP: %s, 获取 %s 地区码失败，错误信息: %v, 追踪地址: %s", ip.String(), detector.name, err, traceURL.String())
+		}
+		return ""
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+	if response.StatusCode != http.StatusOK {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxTraceBodySize))
+	if err != nil {
+		return ""
+	}
+	return detector.parse(string(body))
+}
+
+// lookupColo 在 TCP 及 ICMP 测速模式下，通过一次 HEAD 请求（必要时再访问追踪地址）获取 IP 的地区码
+func lookupColo(ip *net.IPAddr) string {
+	hc := &http.Client{
+		Timeout:   coloLookupTimeout,
+		Transport: newTransport(ip, probeTLSConfig(false)),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse // 阻止重定向
+		},
+	}
+	defer closeTransport(ip, hc.Transport)
+
+	request, err := newRequest(http.MethodHead, URL)
+	if err != nil {
+		return ""
+	}
+	response, err := hc.Do(request)
+	if err != nil {
+		if utils.Debug { // 调试模式下，输出更多信息
+			utils.LogError("IP: %s, 获取地区码失败，错误信息: %v, 测速地址: %s", ip.String(), err, URL)
+		}
+		return ""
+	}
+	_ = response.Body.Close()
+	return detectColo(hc, ip, response.Header)
+}
+
+// LookupResultColos 测速完成后，为最终结果中排名前 PrintNum 且没有地区码的 IP 获取地区码
+// 只对筛选排序后的少量 IP 发送请求，不影响延迟测速的耗时；重新测速及定时检查时无需调用
+func LookupResultColos(speedSet utils.DownloadSpeedSet) {
+	if !ColoLookup {
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < min(len(speedSet), utils.PrintNum); i++ {
+		if speedSet[i].Colo != "" {
+			continue
+		}
+		wg.Add(1)
+		go func(data *utils.PingData) {
+			defer wg.Done()
+			data.Colo = lookupColo(data.IP)
+		}(speedSet[i].PingData)
+	}
+	wg.Wait()
+}
@@ -2,7 +2,6 @@ package task
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
@@ -52,7 +51,11 @@ func checkDownloadDefault() {
 func TestDownloadSpeed(ipSet utils.PingDelaySet) (speedSet utils.DownloadSpeedSet) {
 	checkDownloadDefault()
 	if Disable {
-		return utils.DownloadSpeedSet(ipSet)
+		speedSet = utils.DownloadSpeedSet(ipSet)
+		if utils.ScoreEnabled() { // 启用综合评分时按评分重新排序
+			sort.Stable(speedSet)
+		}
+		return
 	}
 	if len(ipSet) <= 0 { // IP 数组长度(IP数量) 大于 0 时才会继续下载测速
 		utils.LogInfo("延迟测速结果 IP 数量为 0，跳过下载测速。")
@@ -66,7 +69,11 @@ func TestDownloadSpeed(ipSet utils.PingDelaySet) (speedSet utils.DownloadSpeedSe
 		TestCount = testNum
 	}
 
-	utils.LogInfo("开始下载测速（下限：%.2f MB/s, 数量：%d, 队列：%d）", MinSpeed, TestCount, testNum)
+	if DownloadRoutines > 1 {
+		utils.LogInfo("开始下载测速（下限：%.2f MB/s, 数量：%d, 队列：%d, 并发：%d）", MinSpeed, TestCount, testNum, DownloadRoutines)
+	} else {
+		utils.LogInfo("开始下载测速（下限：%.2f MB/s, 数量：%d, 队列：%d）", MinSpeed, TestCount, testNum)
+	}
 	// 控制 下载测速进度条 与 延迟测速进度条 长度一致（强迫症）
 	barA := len(strconv.Itoa(len(ipSet)))
 	barB := "     "
@@ -74,27 +81,26 @@ func TestDownloadSpeed(ipSet utils.PingDelaySet) (speedSet utils.DownloadSpeedSe
 		barB += " "
 	}
 	bar := utils.NewBar(TestCount, barB, "")
+	tested := runDownloads(ipSet, testNum, bar)
+	bar.Done()
+	checkUplink(ipSet, tested)
+	// 按延迟测速结果的顺序取满足条件的 IP，与逐个测速的结果一致
 	for i := 0; i < testNum; i++ {
-		speed, colo := downloadHandler(ipSet[i].IP)
-		ipSet[i].DownloadSpeed = speed
-		if ipSet[i].Colo == "" { // 只有当 Colo 是空的时候，才写入，否则代表之前是 httping 测速并获取过了
-			ipSet[i].Colo = colo
-		}
-		// 在每个 IP 下载测速后，以 [下载速度下限] 条件过滤结果
-		if speed >= MinSpeed*1024*1024 {
-			bar.Grow(1, "")
+		if !tested[i] || ipSet[i].Unusable != "" {
+			continue
+		}
+		if ipSet[i].DownloadSpeed >= MinSpeed*1024*1024 {
 			speedSet = append(speedSet, ipSet[i]) // 高于下载速度下限时，添加到新数组中
 			if len(speedSet) == TestCount {       // 凑够满足条件的 IP 时（下载测速数量 -dn），就跳出循环
 				break
 			}
 		}
 	}
-	bar.Done()
 	if MinSpeed == 0.00 { // 如果没有指定下载速度下限，则直接返回所有测速数据
-		speedSet = utils.DownloadSpeedSet(ipSet)
+		speedSet = utils.DownloadSpeedSet(ipSet).FilterUsable()
 	} else if utils.Debug && len(speedSet) == 0 { // 如果指定了下载速度下限，且是调试模式下，且没有找到任何一个满足条件的 IP 时，返回所有测速数据，供用户查看当前的测速结果，以便适当调低预期测速条件
 		utils.LogDebug("没有满足 下载速度下限 条件的 IP，忽略条件返回所有测速数据（方便下次测速时调整条件）。")
-		speedSet = utils.DownloadSpeedSet(ipSet)
+		speedSet = utils.DownloadSpeedSet(ipSet).FilterUsable()
 	}
 	// 按速度排序
 	sort.Sort(speedSet)
@@ -136,18 +142,14 @@ func printDownloadDebugInfo(ip *net.IPAddr, err error, statusCode int, url, last
 	}
 }
 
-// return download Speed
-func downloadHandler(ip *net.IPAddr) (float64, string) {
-	var lastRedirectURL string // 用于记录最后一次重定向目标，以便在访问错误时输出
-	client := &http.Client{
-		Transport: &http.Transport{
-			DialContext:     getDialContext(ip),
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // 禁用SSL证书验证
-		},
-		Timeout: Timeout,
+// newDownloadClient 创建通过指定 IP 连接下载测速地址的 HTTP 客户端，lastRedirectURL 用于记录最后一次重定向目标
+func newDownloadClient(ip *net.IPAddr, timeout time.Duration, lastRedirectURL *string) *http.Client {
+	return &http.Client{
+		Transport: newTransport(ip, downloadTLSConfig()), // 默认禁用SSL证书验证，开启 VerifyTLS 时验证
+		Timeout:   timeout,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			lastRedirectURL = req.URL.String() // 记录每次重定向的目标，以便在访问错误时输出
-			if len(via) > 10 {                 // 限制最多重定向 10 次
+			*lastRedirectURL = req.URL.String() // 记录每次重定向的目标，以便在访问错误时输出
+			if len(via) > 10 {                  // 限制最多重定向 10 次
 				if utils.Debug { // 调试模式下，输出更多信息
 					utils.LogError("IP: %s, 下载测速地址重定向次数过多，终止测速，下载测速地址: %s", ip.String(), req.URL.String())
 				}
@@ -159,37 +161,58 @@ func downloadHandler(ip *net.IPAddr) (float64, string) {
 			return nil
 		},
 	}
-	req, err := http.NewRequest("GET", URL, nil)
+}
+
+// startDownload 通过指定 IP 请求下载测速地址，完整下载测速及定时任务的轻量下载测速共用
+// 成功时返回状态码为 200 的响应及关闭函数（关闭响应流及传输层），失败时响应为 nil，并返回不可用原因（如证书验证失败，其他错误时为空字符串）
+func startDownload(ip *net.IPAddr, timeout time.Duration) (*http.Response, func(), string) {
+	var lastRedirectURL string // 用于记录最后一次重定向目标，以便在访问错误时输出
+	client := newDownloadClient(ip, timeout, &lastRedirectURL)
+	req, err := newRequest(http.MethodGet, URL)
 	if err != nil {
+		closeTransport(ip, client.Transport)
 		if utils.Debug { // 调试模式下，输出更多信息
 			utils.LogError("IP: %s, 下载测速请求创建失败，错误信息: %v, 下载测速地址: %s", ip.String(), err, URL)
 		}
-		return 0.0, ""
+		return nil, nil, ""
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
-
 	response, err := client.Do(req)
 	if err != nil {
+		closeTransport(ip, client.Transport)
+		if reason := unusableReason(err); reason != "" {
+			utils.LogWarn("IP: %s, 不可用: %v, 下载测速地址: %s", ip.String(), err, URL)
+			return nil, nil, reason
+		}
 		if utils.Debug { // 调试模式下，输出更多信息
 			printDownloadDebugInfo(ip, err, 0, URL, lastRedirectURL, response)
 		}
-		return 0.0, ""
+		return nil, nil, ""
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			if utils.Debug { // 调试模式下，输出更多信息
-				utils.LogError("IP: %s, 关闭下载测速响应流失败，错误信息: %v, 下载测速地址: %s", ip.String(), err, URL)
-			}
+	closeFunc := func() {
+		if err := response.Body.Close(); err != nil && utils.Debug { // 调试模式下，输出更多信息
+			utils.LogError("IP: %s, 关闭下载测速响应流失败，错误信息: %v, 下载测速地址: %s", ip.String(), err, URL)
 		}
-	}(response.Body)
+		closeTransport(ip, client.Transport)
+	}
 	if response.StatusCode != 200 {
+		closeFunc()
 		if utils.Debug { // 调试模式下，输出更多信息
 			printDownloadDebugInfo(ip, nil, response.StatusCode, URL, lastRedirectURL, response)
 		}
-		return 0.0, ""
+		return nil, nil, ""
+	}
+	return response, closeFunc, ""
+}
+
+// 返回下载速度、地区码及不可用原因（如证书验证失败），可用时原因为空字符串
+// meter 不为 nil 时统计下载数据量，用于并发下载测速时估算总带宽及限制总下载速度
+func downloadHandler(ip *net.IPAddr, meter *bandwidthMeter) (float64, string, string) {
+	response, closeFunc, reason := startDownload(ip, Timeout)
+	if response == nil {
+		return 0.0, "", reason
 	}
+	defer closeFunc()
 
 	// 通过头部参数获取地区码
 	colo := getHeaderColo(response.Header)
@@ -199,6 +222,8 @@ func downloadHandler(ip *net.IPAddr) (float64, string) {
 
 	contentLength := response.ContentLength // 文件大小
 	buffer := make([]byte, bufferSize)
+	checker := newContentChecker() // 未指定内容校验条件时为 nil
+	finished := false              // 是否已读取到响应流末尾
 
 	var (
 		contentRead     int64 = 0
@@ -224,10 +249,18 @@ func downloadHandler(ip *net.IPAddr) (float64, string) {
 			break
 		}
 		bufferRead, err := response.Body.Read(buffer)
+		if checker != nil {
+			checker.write(buffer[:bufferRead])
+		}
+		if meter != nil {
+			meter.add(bufferRead)
+		}
 		if err != nil {
 			if err != io.EOF { // 如果文件下载过程中遇到报错（如 Timeout），且并不是因为文件下载完了，则退出循环（终止测速）
 				break
-			} else if contentLength == -1 { // 文件下载完成 且 文件大小未知，则退出循环（终止测速），例如：https://speed.cloudflare.com/__down?bytes=200000000 这样的，如果在 10 秒内就下载完成了，会导致测速结果明显偏低甚至显示为 0.00（下载速度太快时）
+			}
+			finished = true
+			if contentLength == -1 { // 文件下载完成 且 文件大小未知，则退出循环（终止测速），例如：https://speed.cloudflare.com/__down?bytes=200000000 这样的，如果在 10 秒内就下载完成了，会导致测速结果明显偏低甚至显示为 0.00（下载速度太快时）
 				break
 			}
 			// 获取上个时间片
@@ -237,5 +270,59 @@ func downloadHandler(ip *net.IPAddr) (float64, string) {
 		}
 		contentRead += int64(bufferRead)
 	}
-	return e.Value() / (Timeout.Seconds() / 120), colo
+	if checker != nil {
+		if err := checker.verify(finished || contentRead == contentLength, true); err != nil {
+			utils.LogWarn("IP: %s, 不可用: %s: %v, 下载测速地址: %s", ip.String(), reasonContentCheck, err, URL)
+			return 0.0, colo, reasonContentCheck
+		}
+	}
+	return e.Value() / (Timeout.Seconds() / 120), colo, ""
+}
+
+// CheckDownloadSpeed 对指定 IP 进行轻量下载测速，下载时间达到 timeout 或下载数据量达到 maxBytes 时结束，返回平均下载速度（字节/秒）及不可用原因
+// 与完整下载测速不同，这里只关心吞吐量是否明显下降，因此直接以 已下载数据量 / 已用时间 计算速度
+// 与完整下载测速一样进行证书及内容校验，指定了 download_min_size 时至少下载该数据量
+func CheckDownloadSpeed(ip *net.IPAddr, timeout time.Duration, maxBytes int64) (float64, string) {
+	checkDownloadDefault()
+	response, closeFunc, reason := startDownload(ip, timeout)
+	if response == nil {
+		return 0.0, reason
+	}
+	defer closeFunc()
+
+	if maxBytes > 0 && DownloadMinBytes > maxBytes {
+		maxBytes = DownloadMinBytes
+	}
+	timeStart := time.Now()
+	timeEnd := timeStart.Add(timeout)
+	buffer := make([]byte, bufferSize)
+	checker := newContentChecker() // 未指定内容校验条件时为 nil
+	finished := false              // 是否已读取到响应流末尾
+	var contentRead int64
+	for maxBytes <= 0 || contentRead < maxBytes {
+		if time.Now().After(timeEnd) {
+			break
+		}
+		bufferRead, err := response.Body.Read(buffer)
+		contentRead += int64(bufferRead)
+		if checker != nil {
+			checker.write(buffer[:bufferRead])
+		}
+		if err != nil { // 文件下载完成或下载过程中遇到报错（如 Timeout），均以已下载的数据量计算速度
+			finished = err == io.EOF
+			break
+		}
+	}
+	if checker != nil {
+		// 轻量下载测速按设计只下载部分内容，未下载完整时不要求校验 SHA-256
+		if err := checker.verify(finished || contentRead == response.ContentLength, false); err != nil {
+			utils.LogWarn("IP: %s, 不可用: %s: %v, 下载测速地址: %s", ip.String(), reasonContentCheck, err, URL)
+			return 0.0, reasonContentCheck
+		}
+	}
+	elapsed := time.Since(timeStart).Seconds()
+	if elapsed <= 0 {
+		return 0.0, ""
+	}
+	return float64(contentRead) / elapsed, ""
 }
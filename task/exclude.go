@@ -0,0 +1,136 @@
+package task
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+var (
+	ExcludeFile       string        // 排除的 IP 段数据来源，可以是文件路径、URL 或 IP 段，英文逗号分隔
+	ExcludeText       string        // 排除的 IP 段数据，英文逗号分隔
+	BlacklistDuration time.Duration // 检查失败的 IP 临时拉黑的时长，0 表示不拉黑
+
+	blacklist   = make(map[string]time.Time) // 临时黑名单，值为到期时间
+	blacklistMu sync.Mutex
+)
+
+// loadExcludeRanges 读取排除的 IP 段，无效的 IP 段会被跳过并输出警告
+func loadExcludeRanges() []*net.IPNet {
+	var lines []string
+	if ExcludeText != "" {
+		lines = append(lines, strings.Split(ExcludeText, ",")...)
+	}
+	if ExcludeFile != "" {
+		sources, err := readSources(ExcludeFile)
+		if err != nil {
+			utils.LogError("读取排除的 IP 段数据失败: %v", err)
+		}
+		for _, source := range sources {
+			lines = append(lines, source.lines...)
+		}
+	}
+
+	ranges := newIPRanges()
+	var nets []*net.IPNet
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") { // 跳过空行及注释
+			continue
+		}
+		if err := ranges.parseCIDR(line); err != nil {
+			utils.LogWarn("跳过无效的排除 IP 段 [%s]，错误信息: %v", line, err)
+			continue
+		}
+		nets = append(nets, ranges.ipNet)
+	}
+	return nets
+}
+
+// candidateFilter 候选 IP 的过滤条件，生成测速 IP 的地方（完整测速、精细测速）均须经过该过滤
+// 排除列表、临时黑名单及 ASN、国家过滤条件只在创建时读取一次
+type candidateFilter struct {
+	nets       []*net.IPNet    // 排除的 IP 段
+	banned     map[string]bool // 临时黑名单
+	geo        geoFilter
+	excluded   int // 位于排除列表或临时黑名单中的 IP 数量
+	mismatched int // 不属于指定 ASN 或国家的 IP 数量
+}
+
+func newCandidateFilter() *candidateFilter {
+	return &candidateFilter{
+		nets:   loadExcludeRanges(),
+		banned: activeBlacklist(),
+		geo:    loadGeoFilter(),
+	}
+}
+
+// filter 去除位于排除 IP 段或临时黑名单中、以及不属于指定 ASN 或国家的 IP
+// 返回新的切片，不修改 ips（测速全部 IP 时 ips 与生成候选 IP 的数据共用底层数组）
+func (f *candidateFilter) filter(ips []*net.IPAddr) []*net.IPAddr {
+	kept := make([]*net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		if f.banned[ip.String()] || containsIP(f.nets, ip.IP) {
+			f.excluded++
+			continue
+		}
+		if !f.geo.matches(ip.IP) {
+			f.mismatched++
+			continue
+		}
+		kept = append(kept, ip)
+	}
+	return kept
+}
+
+// report 输出被过滤的 IP 数量
+func (f *candidateFilter) report() {
+	if f.excluded > 0 {
+		utils.LogInfo("已排除 %d 个位于排除列表或临时黑名单中的 IP", f.excluded)
+	}
+	if f.mismatched > 0 {
+		utils.LogInfo("已去除 %d 个不属于指定 ASN 或国家的 IP", f.mismatched)
+	}
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// BlacklistIPs 将检查失败的 IP 加入临时黑名单，在 BlacklistDuration 内不会被再次选中
+func BlacklistIPs(ips []string) {
+	if BlacklistDuration <= 0 || len(ips) == 0 {
+		return
+	}
+	blacklistMu.Lock()
+	defer blacklistMu.Unlock()
+	expiry := time.Now().Add(BlacklistDuration)
+	for _, ip := range ips {
+		blacklist[ip] = expiry
+	}
+	utils.LogInfo("已将 %d 个 IP 加入临时黑名单，到期时间: %s", len(ips), expiry.Format(time.DateTime))
+}
+
+// activeBlacklist 返回未到期的黑名单 IP，并清理已到期的记录
+func activeBlacklist() map[string]bool {
+	blacklistMu.Lock()
+	defer blacklistMu.Unlock()
+	now := time.Now()
+	active := make(map[string]bool, len(blacklist))
+	for ip, expiry := range blacklist {
+		if now.After(expiry) {
+			delete(blacklist, ip)
+			continue
+		}
+		active[ip] = true
+	}
+	return active
+}
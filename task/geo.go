@@ -0,0 +1,122 @@
+package task
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+var (
+	GeoCityDB        string // 城市（或国家）数据库路径，支持 MaxMind GeoLite2/GeoIP2 及 DB-IP 的 MMDB 格式
+	GeoASNDB         string // ASN 数据库路径
+	GeoASNFilter     string // 只测速属于指定 ASN 的 IP，英文逗号分隔
+	GeoCountryFilter string // 只测速属于指定国家的 IP（ISO 3166 国家码），英文逗号分隔
+
+	geoOnce    sync.Once
+	geoReaders []*maxminddb.Reader
+)
+
+// geoRecord MMDB 数据库中需要的字段，城市数据库与 ASN 数据库的字段互不冲突，可以解析到同一结构体
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN uint   `maxminddb:"autonomous_system_number"`
+	Org string `maxminddb:"autonomous_system_organization"`
+}
+
+// GeoEnabled 是否配置了 MMDB 数据库
+func GeoEnabled() bool {
+	return GeoCityDB != "" || GeoASNDB != ""
+}
+
+// openGeoDB 打开配置的 MMDB 数据库，打开失败时输出警告并跳过该数据库
+func openGeoDB() []*maxminddb.Reader {
+	geoOnce.Do(func() {
+		for _, path := range []string{GeoCityDB, GeoASNDB} {
+			if path == "" {
+				continue
+			}
+			reader, err := maxminddb.Open(path)
+			if err != nil {
+				utils.LogWarn("打开 MMDB 数据库 [%s] 失败: %v", path, err)
+				continue
+			}
+			geoReaders = append(geoReaders, reader)
+		}
+	})
+	return geoReaders
+}
+
+// lookupGeo 查询 IP 的 ASN、组织、国家及城市，未配置数据库或查询失败时返回空记录
+func lookupGeo(ip net.IP) (record geoRecord) {
+	for _, reader := range openGeoDB() {
+		if err := reader.Lookup(ip, &record); err != nil && utils.Debug { // 调试模式下，输出更多信息
+			utils.LogError("IP: %s, 查询 MMDB 数据库失败，错误信息: %v", ip.String(), err)
+		}
+	}
+	return
+}
+
+// setGeo 将 IP 的 ASN、组织、国家及城市写入测速数据
+func setGeo(data *utils.PingData) {
+	if !GeoEnabled() {
+		return
+	}
+	record := lookupGeo(data.IP.IP)
+	data.ASN = record.ASN
+	data.Org = record.Org
+	data.Country = record.Country.ISOCode
+	data.City = record.City.Names["en"]
+}
+
+// geoFilter ASN 及国家过滤条件，均为空时不过滤
+type geoFilter struct {
+	asns      map[uint]bool
+	countries map[string]bool
+}
+
+// loadGeoFilter 解析 ASN 及国家过滤条件，无法打开 MMDB 数据库时忽略过滤条件
+func loadGeoFilter() (f geoFilter) {
+	asns := make(map[uint]bool)
+	for _, v := range splitSources(GeoASNFilter) {
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(v), "AS"), 10, 32)
+		if err != nil {
+			utils.LogWarn("跳过无效的 ASN [%s]", v)
+			continue
+		}
+		asns[uint(asn)] = true
+	}
+	countries := make(map[string]bool)
+	for _, v := range splitSources(GeoCountryFilter) {
+		countries[strings.ToUpper(v)] = true
+	}
+	if len(asns) == 0 && len(countries) == 0 {
+		return
+	}
+	if len(openGeoDB()) == 0 {
+		utils.LogWarn("未能打开 MMDB 数据库，忽略 ASN 及国家过滤条件")
+		return
+	}
+	return geoFilter{asns: asns, countries: countries}
+}
+
+// matches 判断 IP 是否属于指定的 ASN 及国家
+func (f geoFilter) matches(ip net.IP) bool {
+	if len(f.asns) == 0 && len(f.countries) == 0 {
+		return true
+	}
+	record := lookupGeo(ip)
+	if len(f.asns) > 0 && !f.asns[record.ASN] {
+		return false
+	}
+	return len(f.countries) == 0 || f.countries[record.Country.ISOCode]
+}
@@ -0,0 +1,61 @@
+package task
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+var HTTP3 bool // HTTPing 延迟测速及下载测速是否使用 HTTP/3 (QUIC)
+
+// getQUICDial 与 getDialContext 类似，将 QUIC 连接指向指定 IP 的 UDP 端口
+func getQUICDial(ip *net.IPAddr) func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+	var fakeSourceAddr string
+	if IsIPv4(ip.String()) {
+		fakeSourceAddr = fmt.Sprintf("%s:%d", ip.String(), TCPPort)
+	} else {
+		fakeSourceAddr = fmt.Sprintf("[%s]:%d", ip.String(), TCPPort)
+	}
+	return func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+		return quic.DialAddrEarly(ctx, fakeSourceAddr, tlsCfg, cfg)
+	}
+}
+
+// newTransport 创建通过指定 IP 访问测速地址的传输层，启用 HTTP/3 时使用 QUIC，否则使用 TCP
+func newTransport(ip *net.IPAddr, tlsConfig *tls.Config) http.RoundTripper {
+	if HTTP3 {
+		return &http3.Transport{
+			TLSClientConfig: tlsConfig,
+			Dial:            getQUICDial(ip),
+		}
+	}
+	return &http.Transport{
+		DialContext:     getDialContext(ip),
+		TLSClientConfig: tlsConfig,
+	}
+}
+
+// closeTransport 关闭传输层，HTTP/3 传输层需要关闭才会释放 QUIC 连接及 UDP 套接字
+func closeTransport(ip *net.IPAddr, transport http.RoundTripper) {
+	if t, ok := transport.(*http.Transport); ok {
+		t.CloseIdleConnections() // 自适应测速时无法预知最后一次请求，由此关闭保持的连接
+		return
+	}
+	closer, ok := transport.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		if utils.Debug { // 调试模式下，输出更多信息
+			utils.LogError("IP: %s, 关闭 QUIC 连接失败，错误信息: %v", ip.String(), err)
+		}
+	}
+}
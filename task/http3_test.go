@@ -0,0 +1,134 @@
+package task
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+const http3TestBody = "hello over quic"
+
+// selfSignedCert 生成本地测试服务器使用的自签名证书
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startHTTP3Server 在本地 UDP 端口启动 HTTP/3 测试服务器，返回端口
+func startHTTP3Server(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, http3TestBody)
+	})
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) { // 分段写入，使下载测速能够采样到速度
+		w.Header().Set("Cf-Ray", "0123456789abcdef-NRT")
+		chunk := make([]byte, 64*1024)
+		for i := 0; i < 20; i++ {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	server := &http3.Server{
+		Handler:   mux,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}}),
+	}
+	go func() { _ = server.Serve(conn) }()
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = conn.Close()
+	})
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// setHTTP3Test 将测速设置指向本地 HTTP/3 测试服务器，测试结束后恢复
+func setHTTP3Test(t *testing.T, port int) {
+	t.Helper()
+	origHTTP3, origPort, origURL, origTimeout := HTTP3, TCPPort, URL, Timeout
+	HTTP3, TCPPort, URL, Timeout = true, port, fmt.Sprintf("https://example.com:%d/file", port), time.Second
+	t.Cleanup(func() {
+		HTTP3, TCPPort, URL, Timeout = origHTTP3, origPort, origURL, origTimeout
+	})
+}
+
+func TestHTTP3RoundTrip(t *testing.T) {
+	setHTTP3Test(t, startHTTP3Server(t))
+	ip := &net.IPAddr{IP: net.ParseIP("127.0.0.1")}
+
+	transport := newTransport(ip, probeTLSConfig(true))
+	if _, ok := transport.(*http3.Transport); !ok {
+		t.Fatalf("newTransport() = %T, want *http3.Transport", transport)
+	}
+	defer closeTransport(ip, transport)
+
+	request, err := newRequest(http.MethodGet, strings.TrimSuffix(URL, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := (&http.Client{Transport: transport, Timeout: Timeout}).Do(request)
+	if err != nil {
+		t.Fatalf("HTTP/3 请求失败: %v", err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.ProtoMajor != 3 {
+		t.Errorf("协议 = %s, want HTTP/3", response.Proto)
+	}
+	if string(body) != http3TestBody {
+		t.Errorf("内容 = %q, want %q", body, http3TestBody)
+	}
+}
+
+func TestHTTP3Download(t *testing.T) {
+	setHTTP3Test(t, startHTTP3Server(t))
+	ip := &net.IPAddr{IP: net.ParseIP("127.0.0.1")}
+
+	speed, colo, reason := downloadHandler(ip, nil)
+	if speed <= 0 {
+		t.Errorf("下载速度 = %v, want > 0", speed)
+	}
+	if !strings.EqualFold(colo, "NRT") {
+		t.Errorf("地区码 = %q, want NRT", colo)
+	}
+	if reason != "" {
+		t.Errorf("不可用原因 = %q, want 空", reason)
+	}
+}
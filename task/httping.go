@@ -3,6 +3,7 @@ package task
 import (
 	//"crypto/tls"
 
+	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -24,36 +25,57 @@ var (
 	RegexpColoCityCode    = regexp.MustCompile(`^[a-z]{2}`) // 匹配城市地区码的正则表达式（小写，如 us、cn、uk 等）
 )
 
-// pingReceived pingTotalTime
-func (p *Ping) httping(ip *net.IPAddr) (int, time.Duration, string) {
+// GET 测速时最多读取的响应内容，测速地址通常为较大的下载测速文件
+// GET 测速通过 Range 请求头只请求这部分内容，读完后连接可以继续复用，与 HEAD 测速一样不计入握手耗时
+const httpingBodyLimit = 64 * 1024
+
+var httpingRange = fmt.Sprintf("bytes=0-%d", httpingBodyLimit-1)
+
+// newHttpingRequest 创建 HTTP 测速请求，GET 测速且未自定义 Range 请求头时只请求前 httpingBodyLimit 字节
+func newHttpingRequest() (*http.Request, error) {
+	request, err := newRequest(HttpingMethod, URL)
+	if err == nil && HttpingMethod == http.MethodGet && request.Header.Get("Range") == "" {
+		request.Header.Set("Range", httpingRange)
+	}
+	return request, err
+}
+
+// httpingStatusCode 返回用于判断的 HTTP 状态码，服务器按 httpingRange 返回部分内容（206）时视为 200
+func httpingStatusCode(response *http.Response) int {
+	if response.StatusCode == http.StatusPartialContent && HttpingStatusCode != http.StatusPartialContent &&
+		response.Request != nil && response.Request.Header.Get("Range") == httpingRange {
+		return http.StatusOK
+	}
+	return response.StatusCode
+}
+
+// 返回发送次数及每次成功测速的延迟样本
+func (p *Ping) httping(ip *net.IPAddr) (int, []time.Duration, string) {
 	hc := http.Client{
-		Timeout: time.Second * 2,
-		Transport: &http.Transport{
-			DialContext: getDialContext(ip),
-			//TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // 跳过证书验证
-		},
+		Timeout:   time.Second * 2,
+		Transport: newTransport(ip, probeTLSConfig(false)), // 传入 probeTLSConfig(true) 可跳过证书验证
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse // 阻止重定向
 		},
 	}
+	defer closeTransport(ip, hc.Transport)
 
 	// 先访问一次获得 HTTP 状态码 及 地区码
 	var colo string
 	{
-		request, err := http.NewRequest(http.MethodHead, URL, nil)
+		request, err := newHttpingRequest()
 		if err != nil {
 			if utils.Debug { // 调试模式下，输出更多信息
 				utils.LogError("IP: %s, 延迟测速请求创建失败，错误信息: %v, 测速地址: %s", ip.String(), err, URL)
 			}
-			return 0, 0, ""
+			return 0, nil, ""
 		}
-		request.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
 		response, err := hc.Do(request)
 		if err != nil {
 			if utils.Debug { // 调试模式下，输出更多信息
 				utils.LogError("IP: %s, 延迟测速失败，错误信息: %v, 测速地址: %s", ip.String(), err, URL)
 			}
-			return 0, 0, ""
+			return 0, nil, ""
 		}
 		defer func(Body io.ReadCloser) {
 			err := Body.Close()
@@ -66,32 +88,33 @@ func (p *Ping) httping(ip *net.IPAddr) (int, time.Duration, string) {
 
 		//fmt.Println("IP:", ip, "StatusCode:", response.StatusCode, response.Request.URL)
 		// 如果未指定的 HTTP 状态码，或指定的状态码不合规，则默认只认为 200、301、302 才算 HTTPing 通过
+		statusCode := httpingStatusCode(response)
 		if HttpingStatusCode == 0 || HttpingStatusCode < 100 && HttpingStatusCode > 599 {
-			if response.StatusCode != 200 && response.StatusCode != 301 && response.StatusCode != 302 {
+			if statusCode != 200 && statusCode != 301 && statusCode != 302 {
 				if utils.Debug { // 调试模式下，输出更多信息
 					utils.LogError("IP: %s, 延迟测速终止，HTTP 状态码: %d, 测速地址: %s", ip.String(), response.StatusCode, URL)
 				}
-				return 0, 0, ""
+				return 0, nil, ""
 			}
 		} else {
-			if response.StatusCode != HttpingStatusCode {
+			if statusCode != HttpingStatusCode {
 				if utils.Debug { // 调试模式下，输出更多信息
 					utils.LogError("IP: %s, 延迟测速终止，HTTP 状态码: %d, 指定的 HTTP 状态码 %d, 测速地址: %s", ip.String(), response.StatusCode, HttpingStatusCode, URL)
 				}
-				return 0, 0, ""
+				return 0, nil, ""
 			}
 		}
 
-		_, err = io.Copy(io.Discard, response.Body)
+		_, err = io.Copy(io.Discard, io.LimitReader(response.Body, httpingBodyLimit))
 		if err != nil {
 			if utils.Debug { // 调试模式下，输出更多信息
 				utils.LogError("IP: %s, 读取延迟测速响应流失败，错误信息: %v, 测速地址: %s", ip.String(), err, URL)
 			}
-			return 0, 0, ""
+			return 0, nil, ""
 		}
 
-		// 通过头部参数获取地区码
-		colo = getHeaderColo(response.Header)
+		// 通过头部参数获取地区码，必要时访问该 CDN 的追踪地址
+		colo = detectColo(&hc, ip, response.Header)
 
 		// 只有指定了地区才匹配机场地区码
 		if HttpingCFColo != "" {
@@ -101,119 +124,77 @@ func (p *Ping) httping(ip *net.IPAddr) (int, time.Duration, string) {
 				if utils.Debug { // 调试模式下，输出更多信息
 					utils.LogError("IP: %s, 地区码不匹配: %s", ip.String(), colo)
 				}
-				return 0, 0, ""
+				return 0, nil, ""
 			}
 		}
 	}
 
 	// 循环测速计算延迟
-	success := 0
-	var delay time.Duration
-	for i := 0; i < PingTimes; i++ {
-		request, err := http.NewRequest(http.MethodHead, URL, nil)
+	transmitted, delays := runProbes(func(i int) (time.Duration, error) {
+		request, err := newHttpingRequest()
 		if err != nil {
 			utils.LogFatal("意外的错误，情报告： %v", err)
-			return 0, 0, ""
+			return 0, errProbeAborted
 		}
-		request.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
-		if i == PingTimes-1 {
+		if !AdaptivePing && i == PingTimes-1 {
 			request.Header.Set("Connection", "close")
 		}
 		startTime := time.Now()
 		response, err := hc.Do(request)
 		if err != nil {
-			continue
+			return 0, err
 		}
-		success++
-		_, err = io.Copy(io.Discard, response.Body)
+		delay := time.Since(startTime) // 收到响应头即停止计时，GET 测速时不计入传输响应内容的耗时
+		defer func(Body io.ReadCloser) {
+			_ = Body.Close()
+		}(response.Body)
+		_, err = io.Copy(io.Discard, io.LimitReader(response.Body, httpingBodyLimit))
 		if err != nil {
 			if utils.Debug {
 				utils.LogError("IP: %s, 读取延迟测速响应流失败，错误信息: %v, 测速地址: %s", ip.String(), err, URL)
 			}
-			continue
+			return 0, err
 		}
-		_ = response.Body.Close()
-		duration := time.Since(startTime)
-		delay += duration
-	}
+		return delay, nil
+	})
 
-	return success, delay, colo
+	return transmitted, delays, colo
 }
 
+// cfcolo 支持的匹配方式前缀，前缀对其后的各项均有效，直到出现下一个前缀，如 country:JP,HK,continent:EU
+const (
+	coloPrefixColo      = "COLO:"      // 地区码（默认）
+	coloPrefixCountry   = "COUNTRY:"   // 国家码，如 JP
+	coloPrefixContinent = "CONTINENT:" // 大洲码，如 AS
+	coloPrefixRegion    = "REGION:"    // 地区，如 EasternAsia
+)
+
 func MapColoMap() *sync.Map {
 	if HttpingCFColo == "" {
 		return nil
 	}
 	// 将 -cfcolo 参数指定的地区地区码转为大写并格式化
+	// 国家、大洲及地区以 COUNTRY:JP 等形式保存，地区码直接保存
 	coloList := strings.Split(strings.ToUpper(HttpingCFColo), ",")
 	coloMap := &sync.Map{}
+	prefix := ""
 	for _, colo := range coloList {
-		coloMap.Store(colo, colo)
-	}
-	return coloMap
-}
-
-// 从响应头中获取 地区码 值
-func getHeaderColo(header http.Header) (colo string) {
-	if header.Get("server") != "" {
-		// 如果是 Cloudflare CDN
-		// server: cloudflare
-		// cf-ray: 7bd32409eda7b020-SJC
-		if header.Get("server") == "cloudflare" {
-			if colo = header.Get("cf-ray"); colo != "" {
-				return RegexpColoIATACode.FindString(colo)
-			}
-		}
-		// 如果是 CDN77 CDN（测试地址 https://www.cdn77.com
-		// server: CDN77-Turbo
-		// x-77-pop: losangelesUSCA // 美国的会显示为 USCA 不知道什么情况，暂时没做兼容，只提取 US
-		// x-77-pop: frankfurtDE
-		// x-77-pop: amsterdamNL
-		// x-77-pop: singaporeSG
-		if header.Get("server") == "CDN77-Turbo" {
-			if colo = header.Get("x-77-pop"); colo != "" {
-				return RegexpColoCountryCode.FindString(colo)
-			}
-		}
-		// 如果是 Bunny CDN（测试地址 https://bunny.net
-		// server: BunnyCDN-TW1-1121
-		if colo = header.Get("server"); strings.Contains(colo, "BunnyCDN-") {
-			return RegexpColoCountryCode.FindString(strings.TrimPrefix(colo, "BunnyCDN-")) // 去掉 BunnyCDN- 前缀再去匹配
-		}
-
-		// 如果是 Vercel CDN
-		// server: Vercel
-		if header.Get("server") == "Vercel" {
-			if colo = header.Get("x-vercel-id"); colo != "" {
-				return strings.ToUpper(strings.SplitN(colo, "::", 2)[0])
+		colo = strings.TrimSpace(colo)
+		for _, p := range []string{coloPrefixColo, coloPrefixCountry, coloPrefixContinent, coloPrefixRegion} {
+			if strings.HasPrefix(colo, p) {
+				prefix, colo = p, strings.TrimSpace(strings.TrimPrefix(colo, p))
+				if prefix == coloPrefixColo {
+					prefix = ""
+				}
+				break
 			}
 		}
-	}
-	// 如果是 AWS CloudFront CDN（测试地址 https://d7uri8nf7uskq.cloudfront.net/tools/list-cloudfront-ips
-	// x-amz-cf-pop: SIN52-P1
-	if colo = header.Get("x-amz-cf-pop"); colo != "" {
-		return RegexpColoIATACode.FindString(colo)
-	}
-	// 如果是 Fastly CDN（测试地址 https://fastly.jsdelivr.net/gh/XIU2/CloudflareSpeedTest@master/go.mod
-	// x-served-by: cache-qpg1275-QPG
-	// x-served-by: cache-fra-etou8220141-FRA, cache-hhr-khhr2060043-HHR（最后一个为实际位置）
-	if colo = header.Get("x-served-by"); colo != "" {
-		if matches := RegexpColoIATACode.FindAllString(colo, -1); len(matches) > 0 {
-			return matches[len(matches)-1] // 因为 Fastly 的 x-served-by 可能包含多个地区码，所以只取最后一个
-		}
-	}
-	// Gcore CDN 的头部信息（注意均为城市代码而非国家代码），测试地址 https://assets.gcore.pro/assets/icons/shield-lock.svg
-	// x-id-fe: fr5-hw-edge-gc17
-	// x-shard: fr5-shard0-default
-	// x-id: fr5-hw-edge-gc28
-	if colo = header.Get("x-id-fe"); colo != "" {
-		if colo = RegexpColoCityCode.FindString(colo); colo != "" {
-			return strings.ToUpper(colo) // 将小写的地区码转换为大写
+		if colo == "" {
+			continue
 		}
+		coloMap.Store(prefix+colo, colo)
 	}
-
-	// 如果没有获取到头部信息，说明不是支持的 CDN，则直接返回空字符串
-	return ""
+	return coloMap
 }
 
 // 处理地区码
@@ -230,5 +211,19 @@ func (p *Ping) filterColo(colo string) string {
 	if ok {
 		return colo
 	}
+	// 匹配地区码所在的国家、大洲及地区
+	info, ok := utils.LookupColo(colo)
+	if !ok {
+		return ""
+	}
+	for _, key := range []string{
+		coloPrefixCountry + info.Country,
+		coloPrefixContinent + info.Continent,
+		coloPrefixRegion + strings.ToUpper(info.Region),
+	} {
+		if _, ok := HttpingCFColoMap.Load(key); ok {
+			return colo
+		}
+	}
 	return ""
 }
@@ -0,0 +1,186 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startHttpingServer 启动本地 HTTP 测速服务器，返回端口及建立过的连接数量
+func startHttpingServer(t *testing.T, handler http.HandlerFunc) (int, *atomic.Int32) {
+	t.Helper()
+	conns := &atomic.Int32{}
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server.Listener.Addr().(*net.TCPAddr).Port, conns
+}
+
+// setHttpingTest 将 HTTP 测速设置指向本地测试服务器，测试结束后恢复
+func setHttpingTest(t *testing.T, port int, method string) {
+	t.Helper()
+	origPort, origURL, origMethod, origTimes, origAdaptive, origHTTP3 := TCPPort, URL, HttpingMethod, PingTimes, AdaptivePing, HTTP3
+	TCPPort, URL, HttpingMethod, PingTimes, AdaptivePing, HTTP3 = port, fmt.Sprintf("http://example.com:%d/file", port), method, 4, false, false
+	t.Cleanup(func() {
+		TCPPort, URL, HttpingMethod, PingTimes, AdaptivePing, HTTP3 = origPort, origURL, origMethod, origTimes, origAdaptive, origHTTP3
+	})
+}
+
+func TestHttpingGetReusesConnection(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 1024*1024) // 远大于 httpingBodyLimit 的测速文件
+	tests := []struct {
+		name      string
+		method    string
+		handler   http.HandlerFunc
+		wantConns int32
+	}{
+		{"HEAD", http.MethodHead, func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(body))
+		}, 1},
+		{"GET 支持 Range", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(body))
+		}, 1},
+		{"GET 忽略 Range", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(body)
+		}, 5}, // 响应内容超过 httpingBodyLimit 时连接无法复用，首次访问及每次测速均重新建立连接
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, conns := startHttpingServer(t, tt.handler)
+			setHttpingTest(t, port, tt.method)
+			ip := &net.IPAddr{IP: net.ParseIP("127.0.0.1")}
+
+			transmitted, delays, _ := newPing(nil).httping(ip)
+			if transmitted != PingTimes || len(delays) != PingTimes {
+				t.Fatalf("发送 %d 次，成功 %d 次, want %d", transmitted, len(delays), PingTimes)
+			}
+			if got := conns.Load(); got != tt.wantConns {
+				t.Errorf("建立连接 %d 次, want %d", got, tt.wantConns)
+			}
+		})
+	}
+}
+
+func TestHttpingStatusCode(t *testing.T) {
+	origCode := HttpingStatusCode
+	t.Cleanup(func() { HttpingStatusCode = origCode })
+
+	ranged, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	ranged.Header.Set("Range", httpingRange)
+	custom, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	custom.Header.Set("Range", "bytes=0-0")
+
+	tests := []struct {
+		name     string
+		code     int
+		request  *http.Request
+		status   int
+		expected int
+	}{
+		{"部分内容视为 200", 0, ranged, http.StatusPartialContent, http.StatusOK},
+		{"指定 206 时保持不变", http.StatusPartialContent, ranged, http.StatusPartialContent, http.StatusPartialContent},
+		{"自定义 Range 时保持不变", 0, custom, http.StatusPartialContent, http.StatusPartialContent},
+		{"其他状态码保持不变", 0, ranged, http.StatusNotFound, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			HttpingStatusCode = tt.code
+			got := httpingStatusCode(&http.Response{StatusCode: tt.status, Request: tt.request})
+			if got != tt.expected {
+				t.Errorf("httpingStatusCode() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+// coloMapKeys 返回 MapColoMap 结果中的全部键
+func coloMapKeys(m *sync.Map) []string {
+	var keys []string
+	m.Range(func(key, _ any) bool {
+		keys = append(keys, key.(string))
+		return true
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+func TestMapColoMap(t *testing.T) {
+	origColo := HttpingCFColo
+	t.Cleanup(func() { HttpingCFColo = origColo })
+
+	tests := []struct {
+		cfcolo string
+		want   []string
+	}{
+		{"HKG, nrt", []string{"HKG", "NRT"}},
+		{"colo:SJC", []string{"SJC"}},
+		{"country:JP,HK,continent:EU", []string{"CONTINENT:EU", "COUNTRY:HK", "COUNTRY:JP"}},
+		{"region:EasternAsia", []string{"REGION:EASTERNASIA"}},
+		{"country:jp,colo:lax,fra", []string{"COUNTRY:JP", "FRA", "LAX"}},
+		{"HKG,,country:,  ", []string{"HKG"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cfcolo, func(t *testing.T) {
+			HttpingCFColo = tt.cfcolo
+			if got := coloMapKeys(MapColoMap()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MapColoMap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	HttpingCFColo = ""
+	if m := MapColoMap(); m != nil {
+		t.Errorf("未指定 cfcolo 时 MapColoMap() = %v, want nil", coloMapKeys(m))
+	}
+}
+
+func TestFilterColo(t *testing.T) {
+	origColo, origMap := HttpingCFColo, HttpingCFColoMap
+	t.Cleanup(func() { HttpingCFColo, HttpingCFColoMap = origColo, origMap })
+
+	tests := []struct {
+		name   string
+		cfcolo string
+		colo   string
+		want   string
+	}{
+		{"未指定 cfcolo", "", "HKG", "HKG"},
+		{"没有地区码", "HKG", "", ""},
+		{"地区码匹配", "HKG,NRT", "NRT", "NRT"},
+		{"地区码不匹配", "HKG", "SJC", ""},
+		{"国家匹配", "country:JP", "NRT", "NRT"},
+		{"国家不匹配", "country:JP", "HKG", ""},
+		{"大洲匹配", "continent:EU", "FRA", "FRA"},
+		{"大洲不匹配", "continent:EU", "SJC", ""},
+		{"地区匹配", "region:EasternAsia", "HKG", "HKG"},
+		{"地区不匹配", "region:WesternEurope", "HKG", ""},
+		{"多种方式混合", "SJC,country:DE", "FRA", "FRA"},
+		{"只有国家码的 CDN", "country:JP", "JP", "JP"},
+		{"只有国家码的 CDN 匹配大洲", "continent:AS", "JP", "JP"},
+		{"Vercel 地区码", "country:HK", "HKG1", "HKG1"},
+		{"Vercel 地区码不匹配", "country:JP", "HKG1", ""},
+		{"未知的地区码", "country:JP", "ZZZ", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			HttpingCFColo = tt.cfcolo
+			HttpingCFColoMap = MapColoMap()
+			if got := newPing(nil).filterColo(tt.colo); got != tt.want {
+				t.Errorf("filterColo(%q) = %q, want %q", tt.colo, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package task
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	icmpTimeout       = time.Second * 1
+	icmpProtocolIPv4  = 1  // ICMP
+	icmpProtocolIPv6  = 58 // ICMPv6
+	icmpPayloadLength = 32
+)
+
+var (
+	ICMPing bool
+
+	icmpID         uint32       // 用于区分各 IP 的 Echo 标识符（原始套接字会收到所有 ICMP 报文）
+	icmpPrivileged [2]bool      // IPv4、IPv6 是否使用原始套接字（特权模式）
+	icmpModeOnce   [2]sync.Once // 每个地址族只检测一次可用的模式
+)
+
+// icmpNetwork 返回指定地址族 ICMP 监听使用的网络类型及地址
+// 特权模式使用原始套接字（需要 root 或 CAP_NET_RAW），非特权模式使用 Linux 的 ICMP 数据报套接字（需要 net.ipv4.ping_group_range 包含当前用户组）
+func icmpNetwork(isIPv4, privileged bool) (network, address string) {
+	switch {
+	case isIPv4 && privileged:
+		return "ip4:icmp", "0.0.0.0"
+	case isIPv4:
+		return "udp4", "0.0.0.0"
+	case privileged:
+		return "ip6:ipv6-icmp", "::"
+	default:
+		return "udp6", "::"
+	}
+}
+
+// listenICMP 创建 ICMP 监听，首次调用时优先尝试特权模式，失败后改用非特权模式，并记住可用的模式
+func listenICMP(isIPv4 bool) (*icmp.PacketConn, bool, error) {
+	family := 0
+	if !isIPv4 {
+		family = 1
+	}
+	icmpModeOnce[family].Do(func() {
+		network, address := icmpNetwork(isIPv4, true)
+		conn, err := icmp.ListenPacket(network, address)
+		if err == nil {
+			_ = conn.Close()
+			icmpPrivileged[family] = true
+			return
+		}
+		if utils.Debug { // 调试模式下，输出更多信息
+			utils.LogDebug("创建 ICMP 原始套接字失败，改用非特权模式，错误信息: %v", err)
+		}
+	})
+	privileged := icmpPrivileged[family]
+	network, address := icmpNetwork(isIPv4, privileged)
+	conn, err := icmp.ListenPacket(network, address)
+	return conn, privileged, err
+}
+
+// 返回发送次数及每次成功测速的延迟样本
+func (p *Ping) icmping(ip *net.IPAddr) (transmitted int, delays []time.Duration) {
+	isIPv4 := IsIPv4(ip.String())
+	conn, privileged, err := listenICMP(isIPv4)
+	if err != nil {
+		if utils.Debug { // 调试模式下，输出更多信息
+			utils.LogError("IP: %s, 创建 ICMP 监听失败，错误信息: %v", ip.String(), err)
+		}
+		return
+	}
+	defer func(conn *icmp.PacketConn) {
+		err := conn.Close()
+		if err != nil {
+			if utils.Debug { // 调试模式下，输出更多信息
+				utils.LogError("IP: %s, 关闭 ICMP 监听失败，错误信息: %v", ip.String(), err)
+			}
+		}
+	}(conn)
+
+	var dst net.Addr = &net.IPAddr{IP: ip.IP, Zone: ip.Zone}
+	if !privileged {
+		dst = &net.UDPAddr{IP: ip.IP, Zone: ip.Zone}
+	}
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	protocol := icmpProtocolIPv4
+	if !isIPv4 {
+		echoType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		protocol = icmpProtocolIPv6
+	}
+
+	id := int(atomic.AddUint32(&icmpID, 1) & 0xffff)
+	return runProbes(func(seq int) (time.Duration, error) {
+		if ok, delay := icmpEcho(conn, dst, ip, echoType, replyType, protocol, id, seq, privileged); ok {
+			return delay, nil
+		}
+		return 0, errProbeFailed
+	})
+}
+
+// icmpEcho 发送一次 ICMP Echo 请求并等待对应的 Echo 应答
+func icmpEcho(conn *icmp.PacketConn, dst net.Addr, ip *net.IPAddr, echoType, replyType icmp.Type, protocol, id, seq int, privileged bool) (bool, time.Duration) {
+	request, err := (&icmp.Message{
+		Type: echoType,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: make([]byte, icmpPayloadLength)},
+	}).Marshal(nil) // ICMPv6 的校验和由内核计算
+	if err != nil {
+		return false, 0
+	}
+
+	startTime := time.Now()
+	if err := conn.SetDeadline(startTime.Add(icmpTimeout)); err != nil {
+		return false, 0
+	}
+	if _, err := conn.WriteTo(request, dst); err != nil {
+		if utils.Debug { // 调试模式下，输出更多信息
+			utils.LogError("IP: %s, 发送 ICMP 请求失败，错误信息: %v", ip.String(), err)
+		}
+		return false, 0
+	}
+
+	buffer := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buffer)
+		if err != nil { // 超时
+			return false, 0
+		}
+		if !icmpPeerIP(peer).Equal(ip.IP) {
+			continue
+		}
+		reply, err := icmp.ParseMessage(protocol, buffer[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		// 非特权模式下 Echo 标识符由内核分配并过滤，只需比较序号
+		if !ok || echo.Seq != seq || (privileged && echo.ID != id) {
+			continue
+		}
+		return true, time.Since(startTime)
+	}
+}
+
+// icmpPeerIP 获取 ICMP 应答的来源 IP
+func icmpPeerIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package task
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"regexp"
+	"strings"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+const bodyCheckSize = 64 * 1024 // 用于匹配开头内容及正则表达式的数据量
+
+var (
+	DownloadSHA256   string         // 下载内容的 SHA-256（十六进制），只在下载完整时校验
+	DownloadMinBytes int64          // 至少下载的数据量（字节），0 表示不限制
+	DownloadPrefix   string         // 下载内容须以此开头
+	DownloadRegexp   *regexp.Regexp // 下载内容的前 64 KB 须匹配该正则表达式
+)
+
+// ParseDownloadSHA256 检查下载内容的 SHA-256，支持 sha256: 前缀，无效时输出警告并忽略
+func ParseDownloadSHA256(s string) string {
+	s = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "sha256:"))
+	if s == "" {
+		return ""
+	}
+	if sum, err := hex.DecodeString(s); err != nil || len(sum) != sha256.Size {
+		utils.LogWarn("忽略无效的下载内容 SHA-256 [%s]，应为 64 位十六进制字符串", s)
+		return ""
+	}
+	return s
+}
+
+// hasPartialCheck 是否指定了未下载完整时也能校验的条件（下载数据量、开头内容或正则表达式）
+func hasPartialCheck() bool {
+	return DownloadMinBytes > 0 || DownloadPrefix != "" || DownloadRegexp != nil
+}
+
+// ParseDownloadRegexp 编译下载内容的正则表达式，无效时输出警告并忽略
+func ParseDownloadRegexp(s string) *regexp.Regexp {
+	if s == "" {
+		return nil
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		utils.LogWarn("忽略无效的下载内容正则表达式 [%s]，错误信息: %v", s, err)
+		return nil
+	}
+	return re
+}
+
+// contentChecker 在下载测速过程中记录下载内容，用于校验内容是否被篡改（如中间设备返回的错误页面）
+type contentChecker struct {
+	hash hash.Hash // 未指定 SHA-256 时为 nil
+	head []byte    // 下载内容的开头部分
+	read int64     // 已下载的数据量
+}
+
+// newContentChecker 未指定任何校验条件时返回 nil
+func newContentChecker() *contentChecker {
+	if DownloadSHA256 == "" && DownloadMinBytes <= 0 && DownloadPrefix == "" && DownloadRegexp == nil {
+		return nil
+	}
+	c := &contentChecker{}
+	if DownloadSHA256 != "" {
+		c.hash = sha256.New()
+	}
+	return c
+}
+
+func (c *contentChecker) write(p []byte) {
+	if c.hash != nil {
+		c.hash.Write(p)
+	}
+	if n := bodyCheckSize - len(c.head); n > 0 {
+		c.head = append(c.head, p[:min(n, len(p))]...)
+	}
+	c.read += int64(len(p))
+}
+
+// verify 校验下载内容，complete 表示是否已下载完整（未下载完整时无法校验 SHA-256）
+// strict 为 true 且 SHA-256 是唯一的校验条件时，未下载完整视为校验失败
+func (c *contentChecker) verify(complete, strict bool) error {
+	if DownloadMinBytes > 0 && c.read < DownloadMinBytes {
+		return fmt.Errorf("下载数据量 %d 字节，少于 %d 字节", c.read, DownloadMinBytes)
+	}
+	if DownloadPrefix != "" && !bytes.HasPrefix(c.head, []byte(DownloadPrefix)) {
+		return fmt.Errorf("内容开头不匹配")
+	}
+	if DownloadRegexp != nil && !DownloadRegexp.Match(c.head) {
+		return fmt.Errorf("内容不匹配正则表达式 %s", DownloadRegexp.String())
+	}
+	if c.hash != nil {
+		if !complete {
+			if strict && !hasPartialCheck() { // SHA-256 是唯一的校验条件时，未下载完整视为校验失败，避免持续返回错误内容的 IP 通过校验
+				return fmt.Errorf("下载测速时间内未下载完整，无法校验 SHA-256")
+			}
+			if utils.Debug { // 调试模式下，输出更多信息
+				utils.LogDebug("下载测速时间内未下载完整，跳过 SHA-256 校验")
+			}
+			return nil
+		}
+		if sum := hex.EncodeToString(c.hash.Sum(nil)); sum != DownloadSHA256 {
+			return fmt.Errorf("SHA-256 不匹配: %s", sum)
+		}
+	}
+	return nil
+}
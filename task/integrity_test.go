@@ -0,0 +1,77 @@
+package task
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestContentCheckerVerify(t *testing.T) {
+	origSHA256, origMinBytes, origPrefix, origRegexp := DownloadSHA256, DownloadMinBytes, DownloadPrefix, DownloadRegexp
+	t.Cleanup(func() {
+		DownloadSHA256, DownloadMinBytes, DownloadPrefix, DownloadRegexp = origSHA256, origMinBytes, origPrefix, origRegexp
+	})
+
+	content := []byte("hello world")
+	sum := sha256.Sum256(content)
+	match := hex.EncodeToString(sum[:])
+	mismatch := hex.EncodeToString(make([]byte, sha256.Size))
+
+	tests := []struct {
+		name      string
+		sha256    string
+		minBytes  int64
+		prefix    string
+		regexp    string
+		complete  bool
+		strict    bool
+		wantError bool
+	}{
+		// 只校验 SHA-256
+		{"完整且匹配", match, 0, "", "", true, true, false},
+		{"完整但不匹配", mismatch, 0, "", "", true, true, true},
+		{"未下载完整时失败", match, 0, "", "", false, true, true},
+		{"未下载完整且不匹配时失败", mismatch, 0, "", "", false, true, true},
+		{"非严格模式下未下载完整时跳过", mismatch, 0, "", "", false, false, false},
+		// SHA-256 及其他校验条件
+		{"指定下载数据量时未下载完整跳过 SHA-256", mismatch, 5, "", "", false, true, false},
+		{"指定开头内容时未下载完整跳过 SHA-256", mismatch, 0, "hello", "", false, true, false},
+		{"指定正则表达式时未下载完整跳过 SHA-256", mismatch, 0, "", "wor?ld", false, true, false},
+		{"指定其他条件时完整但不匹配", mismatch, 0, "hello", "", true, true, true},
+		{"其他条件不匹配", match, 0, "bye", "", true, true, true},
+		// 不校验 SHA-256
+		{"下载数据量不足", "", 100, "", "", true, true, true},
+		{"下载数据量足够", "", 5, "", "", false, true, false},
+		{"开头内容匹配", "", 0, "hello", "", false, true, false},
+		{"开头内容不匹配", "", 0, "world", "", true, true, true},
+		{"正则表达式匹配", "", 0, "", `^hello\s`, false, true, false},
+		{"正则表达式不匹配", "", 0, "", `^world`, true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			DownloadSHA256, DownloadMinBytes, DownloadPrefix = tt.sha256, tt.minBytes, tt.prefix
+			DownloadRegexp = ParseDownloadRegexp(tt.regexp)
+			c := newContentChecker()
+			if c == nil {
+				t.Fatal("newContentChecker() = nil")
+			}
+			c.write(content[:5])
+			c.write(content[5:])
+			if err := c.verify(tt.complete, tt.strict); (err != nil) != tt.wantError {
+				t.Errorf("verify(%v, %v) error = %v, wantError %v", tt.complete, tt.strict, err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestNewContentCheckerDisabled(t *testing.T) {
+	origSHA256, origMinBytes, origPrefix, origRegexp := DownloadSHA256, DownloadMinBytes, DownloadPrefix, DownloadRegexp
+	t.Cleanup(func() {
+		DownloadSHA256, DownloadMinBytes, DownloadPrefix, DownloadRegexp = origSHA256, origMinBytes, origPrefix, origRegexp
+	})
+
+	DownloadSHA256, DownloadMinBytes, DownloadPrefix, DownloadRegexp = "", 0, "", nil
+	if c := newContentChecker(); c != nil {
+		t.Errorf("未指定校验条件时 newContentChecker() = %v, want nil", c)
+	}
+}
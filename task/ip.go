@@ -1,12 +1,8 @@
 package task
 
 import (
-	"bufio"
-	"io"
 	"math/rand"
 	"net"
-	"net/http"
-	"os"
 	"strconv"
 	"strings"
 
@@ -18,29 +14,6 @@ func isURL(s string) bool {
 	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
 }
 
-// readIPsFromURL downloads the content from a URL and returns it as a slice of strings
-func readIPsFromURL(url string) ([]string, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			if utils.Debug {
-				utils.LogError("Error closing response body: %v", err)
-			}
-		}
-	}(resp.Body)
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return strings.Split(string(body), "\n"), nil
-}
-
 const defaultInputFile = "ip.txt"
 
 var (
@@ -97,11 +70,9 @@ func (r *IPRanges) fixIP(ip string) string {
 }
 
 // 解析 IP 段，获得 IP、IP 范围、子网掩码
-func (r *IPRanges) parseCIDR(ip string) {
-	var err error
-	if r.firstIP, r.ipNet, err = net.ParseCIDR(r.fixIP(ip)); err != nil {
-		utils.LogFatal("ParseCIDR err: %v", err)
-	}
+func (r *IPRanges) parseCIDR(ip string) (err error) {
+	r.firstIP, r.ipNet, err = net.ParseCIDR(r.fixIP(ip))
+	return
 }
 
 func (r *IPRanges) appendIPv4(d byte) {
@@ -198,82 +169,68 @@ func IsMixedMode() bool {
 	return IPv4File == "" && IPv6File == "" && IPFile != ""
 }
 
-func loadIPRanges() []*net.IPAddr {
-	ranges := newIPRanges()
+// readIPSources 读取 IP 段数据，ip_text 优先，否则根据模式读取对应的数据来源列表
+func readIPSources() ([]ipSource, error) {
 	if IPText != "" { // 从参数中获取 IP 段数据
-		IPs := strings.Split(IPText, ",") // 以逗号分隔为数组并循环遍历
-		for _, IP := range IPs {
-			IP = strings.TrimSpace(IP) // 去除首尾的空白字符（空格、制表符、换行符等）
-			if IP == "" {              // 跳过空的（即开头、结尾或连续多个 ,, 的情况）
-				continue
-			}
-			ranges.parseCIDR(IP) // 解析 IP 段，获得 IP、IP 范围、子网掩码
-			if IsIPv4(IP) {      // 生成要测速的所有 IPv4 / IPv6 地址（单个/随机/全部）
-				ranges.chooseIPv4()
-			} else {
-				ranges.chooseIPv6()
-			}
+		return []ipSource{{name: "ip_text", lines: strings.Split(IPText, ",")}}, nil // 以逗号分隔为数组
+	}
+	if IsBothMode() { // 同时测试IPv4和IPv6时（如校验 IP 段数据），分别读取两个文件，不修改 IPFile
+		ipv4Sources, err := readSources(IPv4File)
+		if err != nil {
+			return nil, err
 		}
-	} else { // 从文件中获取 IP 段数据
-		// 根据模式选择文件
-		var filename string
-		if IsIPv4Mode() {
-			filename = IPv4File
-		} else if IsIPv6Mode() {
-			filename = IPv6File
-		} else if IsMixedMode() {
-			filename = IPFile
-		} else {
-			// 默认情况，使用IPFile
-			if IPFile == "" {
-				IPFile = defaultInputFile
-			}
-			filename = IPFile
+		ipv6Sources, err := readSources(IPv6File)
+		if err != nil {
+			return nil, err
 		}
-
-		var lines []string
-		var err error
-
-		if isURL(filename) {
-			lines, err = readIPsFromURL(filename)
-			if err != nil {
-				utils.LogFatal("readIPsFromURL err: %v", err)
-			}
-		} else {
-			file, err := os.Open(filename)
-			if err != nil {
-				utils.LogFatal("os.Open err: %v", err)
-			}
-			defer func(file *os.File) {
-				err := file.Close()
-				if err != nil {
-					if utils.Debug {
-						utils.LogError("Error closing file: %v", err)
-					}
-				}
-			}(file)
-			scanner := bufio.NewScanner(file)
-			for scanner.Scan() {
-				lines = append(lines, scanner.Text())
-			}
+		for i := range ipv4Sources {
+			ipv4Sources[i].family = "IPv4"
 		}
-
-		for _, line := range lines {
-			line = strings.TrimSpace(line) // 去除首尾的空白字符（空格、制表符、换行符等）
-			if line == "" {                // 跳过空行
-				continue
-			}
-			// 根据当前模式决定是否处理该IP
-			if (IsIPv4Mode() && !IsIPv4(line)) || (IsIPv6Mode() && IsIPv4(line)) {
-				continue // 如果是IPv4模式但IP是IPv6，或者是IPv6模式但IP是IPv4，则跳过
-			}
-			ranges.parseCIDR(line) // 解析 IP 段，获得 IP、IP 范围、子网掩码
-			if IsIPv4(line) {      // 生成要测速的所有 IPv4 / IPv6 地址（单个/随机/全部）
-				ranges.chooseIPv4()
-			} else {
-				ranges.chooseIPv6()
-			}
+		for i := range ipv6Sources {
+			ipv6Sources[i].family = "IPv6"
 		}
+		return append(ipv4Sources, ipv6Sources...), nil
+	}
+	// 从文件中获取 IP 段数据，根据模式选择文件
+	var filename string
+	if IsIPv4Mode() {
+		filename = IPv4File
+	} else if IsIPv6Mode() {
+		filename = IPv6File
+	} else if IsMixedMode() {
+		filename = IPFile
+	} else {
+		// 默认情况，使用IPFile
+		if IPFile == "" {
+			IPFile = defaultInputFile
+		}
+		filename = IPFile
+	}
+	return readSources(filename)
+}
+
+// loadIPRanges 读取并解析 IP 段数据，生成要测速的 IP
+// 无效的 IP 段会被跳过并输出警告，重复或被其他 IP 段包含的 IP 段会被去除，
+// 位于排除列表或临时黑名单中、以及不属于指定 ASN 或国家的 IP 不会被选中
+// 同时返回有效的 IP 段，精细测速只在其中选取 IP
+func loadIPRanges() ([]*net.IPAddr, []*net.IPNet) {
+	result, err := parseIPRanges()
+	if err != nil {
+		utils.LogError("读取 IP 段数据失败: %v", err)
+		return nil, nil
+	}
+	result.report()
+
+	ranges := newIPRanges()
+	var candidates []candidateRange
+	inputRanges := make([]*net.IPNet, 0, len(result.entries))
+	for _, entry := range result.entries {
+		_ = ranges.parseCIDR(entry.text) // 已在 parseIPRanges 中校验
+		candidates = append(candidates, ranges.candidates(entry.isIPv4()))
+		inputRanges = append(inputRanges, entry.ipNet)
 	}
-	return ranges.ips
+	filter := newCandidateFilter()
+	ips := sampleCandidates(candidates, filter)
+	filter.report()
+	return ips, inputRanges
 }
@@ -0,0 +1,178 @@
+package task
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+const (
+	defaultDownloadRoutines = 1
+	bandwidthSampleInterval = time.Millisecond * 500
+	uplinkLimitRatio        = 1.5 // 单独测速的速度超过并发测速的该倍数时，认为并发测速受本地带宽限制
+)
+
+var (
+	DownloadRoutines  = defaultDownloadRoutines // 同时进行下载测速的 IP 数量
+	DownloadStartRate float64                   // 开始测速下一个 IP 的总下载速度阈值，单位 MB/s，0 表示不限制
+	DownloadMaxRate   float64                   // 所有下载测速的总下载速度上限，单位 MB/s，0 表示不限制
+)
+
+func checkParallelDefault() {
+	if DownloadRoutines <= 0 {
+		DownloadRoutines = defaultDownloadRoutines
+	}
+	if DownloadStartRate < 0 {
+		DownloadStartRate = 0
+	}
+	if DownloadMaxRate < 0 {
+		DownloadMaxRate = 0
+	}
+}
+
+// bandwidthMeter 统计所有下载测速的总下载数据量，用于估算当前的总带宽
+// 指定了总下载速度上限时同时作为共享的令牌桶，限制所有下载测速的总下载速度
+type bandwidthMeter struct {
+	bytes atomic.Int64
+	limit float64 // 总下载速度上限，单位 字节/秒，0 表示不限制
+
+	mu   sync.Mutex
+	next time.Time // 按上限计算，已读取的数据量允许的最早时间
+}
+
+// newBandwidthMeter 创建统计总下载数据量的 bandwidthMeter，上限为 DownloadMaxRate
+func newBandwidthMeter() *bandwidthMeter {
+	return &bandwidthMeter{limit: DownloadMaxRate * 1024 * 1024}
+}
+
+// add 统计读取的数据量，超过总下载速度上限时等待，直到平均速度回到上限以内
+func (m *bandwidthMeter) add(n int) {
+	m.bytes.Add(int64(n))
+	if m.limit <= 0 || n <= 0 {
+		return
+	}
+	m.mu.Lock()
+	now := time.Now()
+	if m.next.Before(now) { // 空闲期间不累积额度，避免之后短时间内超过上限
+		m.next = now
+	}
+	m.next = m.next.Add(time.Duration(float64(n) / m.limit * float64(time.Second)))
+	wait := m.next.Sub(now)
+	m.mu.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// waitBelow 等待总下载速度低于阈值，active 为正在进行的下载测速数量，没有下载测速时无需等待
+// 每隔 bandwidthSampleInterval 采样一次总下载速度
+func (m *bandwidthMeter) waitBelow(limit float64, active func() int) {
+	if limit <= 0 {
+		return
+	}
+	ticker := time.NewTicker(bandwidthSampleInterval)
+	defer ticker.Stop()
+	for active() > 0 {
+		start := m.bytes.Load()
+		<-ticker.C
+		if rate := float64(m.bytes.Load()-start) / bandwidthSampleInterval.Seconds(); rate < limit {
+			return
+		}
+	}
+}
+
+// runDownloads 对前 testNum 个 IP 进行下载测速，最多同时测速 DownloadRoutines 个 IP
+// 指定了 DownloadStartRate 时，只有总下载速度低于阈值才开始测速下一个 IP，减少本地带宽成为瓶颈的情况
+// 这只是开始测速的条件，并不限制已开始的测速；指定了 DownloadMaxRate 时，所有测速的总下载速度不会超过该上限
+// 凑够满足条件的 IP 后不再开始新的测速，返回每个 IP 是否已测速
+func runDownloads(ipSet utils.PingDelaySet, testNum int, bar *utils.Bar) []bool {
+	checkParallelDefault()
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		qualified int // 满足下载速度下限的 IP 数量
+		active    int // 正在进行的下载测速数量
+	)
+	tested := make([]bool, testNum)
+	meter := newBandwidthMeter()
+	control := make(chan struct{}, DownloadRoutines)
+	activeCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return active
+	}
+
+	for i := 0; i < testNum; i++ {
+		control <- struct{}{}
+		meter.waitBelow(DownloadStartRate*1024*1024, activeCount)
+		mu.Lock()
+		if qualified >= TestCount { // 凑够满足条件的 IP 时（下载测速数量 -dn），就不再开始新的测速
+			mu.Unlock()
+			<-control
+			break
+		}
+		active++
+		mu.Unlock()
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-control
+				wg.Done()
+			}()
+			speed, colo, reason := downloadHandler(ipSet[i].IP, meter)
+			mu.Lock()
+			defer mu.Unlock()
+			active--
+			tested[i] = true
+			ipSet[i].DownloadSpeed = speed
+			if ipSet[i].Colo == "" { // 只有当 Colo 是空的时候，才写入，否则代表之前是 httping 测速并获取过了
+				ipSet[i].Colo = colo
+			}
+			if reason != "" { // 证书验证失败等情况说明该 IP 不可信，无论速度如何均不可用
+				ipSet[i].Unusable = reason
+				return
+			}
+			// 在每个 IP 下载测速后，以 [下载速度下限] 条件过滤结果
+			if speed >= MinSpeed*1024*1024 {
+				qualified++
+				if qualified <= TestCount {
+					bar.Grow(1, "")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	return tested
+}
+
+// checkUplink 并发下载测速后，单独重新测速速度最快的 IP，如果明显快于并发测速的结果，说明并发测速受本地带宽限制
+func checkUplink(ipSet utils.PingDelaySet, tested []bool) {
+	if DownloadRoutines <= 1 {
+		return
+	}
+	fastest := -1
+	for i := range tested {
+		if tested[i] && ipSet[i].Unusable == "" && (fastest == -1 || ipSet[i].DownloadSpeed > ipSet[fastest].DownloadSpeed) {
+			fastest = i
+		}
+	}
+	if fastest == -1 || ipSet[fastest].DownloadSpeed <= 0 {
+		return
+	}
+	ip := ipSet[fastest].IP
+	solo, _, reason := downloadHandler(ip, newBandwidthMeter()) // 单独测速同样受总下载速度上限限制，与并发测速在相同条件下比较
+	if reason != "" {
+		return
+	}
+	concurrent := ipSet[fastest].DownloadSpeed
+	if utils.Debug { // 调试模式下，输出更多信息
+		utils.LogDebug("IP: %s, 并发测速 %.2f MB/s，单独测速 %.2f MB/s", ip.String(), concurrent/1024/1024, solo/1024/1024)
+	}
+	if solo > concurrent*uplinkLimitRatio {
+		utils.LogWarn("并发下载测速结果可能受本地带宽限制（IP %s 单独测速 %.2f MB/s，并发测速 %.2f MB/s），建议减少 download_routines 或设置 download_start_rate",
+			ip.String(), solo/1024/1024, concurrent/1024/1024)
+	}
+}
@@ -0,0 +1,46 @@
+package task
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBandwidthMeterLimit(t *testing.T) {
+	const limit = 2 * 1024 * 1024 // 2 MB/s
+	const duration = 500 * time.Millisecond
+	m := &bandwidthMeter{limit: limit}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ { // 模拟 4 个并发的下载测速
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Since(start) < duration {
+				m.add(bufferSize)
+			}
+		}()
+	}
+	wg.Wait()
+	rate := float64(m.bytes.Load()) / time.Since(start).Seconds()
+	if rate > limit*1.1 {
+		t.Errorf("总下载速度 = %.0f B/s, want <= %d B/s", rate, limit)
+	}
+	if rate < limit*0.5 {
+		t.Errorf("总下载速度 = %.0f B/s, 远低于上限 %d B/s", rate, limit)
+	}
+}
+
+func TestBandwidthMeterUnlimited(t *testing.T) {
+	m := &bandwidthMeter{}
+	start := time.Now()
+	for i := 0; i < 10000; i++ {
+		m.add(bufferSize)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("未指定上限时耗时 %v，不应等待", elapsed)
+	}
+	if got := m.bytes.Load(); got != 10000*bufferSize {
+		t.Errorf("统计的数据量 = %d, want %d", got, 10000*bufferSize)
+	}
+}
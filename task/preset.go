@@ -0,0 +1,123 @@
+package task
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+const presetPrefix = "preset:" // 内置 IP 段数据来源的前缀，如 preset:cloudflare
+
+//go:embed presets/*.txt
+var presetFS embed.FS
+
+var PresetRefresh bool // 是否从 CDN 官方接口更新内置的 IP 段数据
+
+// presetURLs 各 CDN 公布 IP 段的接口，与 getHeaderColo 支持识别地区码的 CDN 对应
+var presetURLs = map[string][]string{
+	"cloudflare": {"https://www.cloudflare.com/ips-v4", "https://www.cloudflare.com/ips-v6"},
+	"cloudfront": {"https://d7uri8nf7uskq.cloudfront.net/tools/list-cloudfront-ips"},
+	"fastly":     {"https://api.fastly.com/public-ip-list"},
+	"gcore":      {"https://api.gcore.com/cdn/public-ip-list"},
+	"cdn77":      {"https://stat.ripe.net/data/announced-prefixes/data.json?resource=AS60068"},
+	"bunny":      {"https://bunnycdn.com/api/system/edgeserverlist", "https://bunnycdn.com/api/system/edgeserverlist/IPv6"},
+}
+
+// isPreset 判断数据来源是否为内置的 IP 段数据
+func isPreset(source string) bool {
+	return strings.HasPrefix(strings.ToLower(source), presetPrefix)
+}
+
+// presetNames 返回全部内置 IP 段数据的名称
+func presetNames() []string {
+	names := make([]string, 0, len(presetURLs))
+	for name := range presetURLs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readPreset 读取内置的 IP 段数据，开启 PresetRefresh 或未内置数据时从 CDN 官方接口获取（带缓存）
+// 获取失败时使用内置的数据
+func readPreset(source string) ([]string, error) {
+	name := strings.ToLower(source[len(presetPrefix):])
+	urls, ok := presetURLs[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的内置 IP 段数据 [%s]，可选: %s", name, strings.Join(presetNames(), ", "))
+	}
+
+	content, err := presetFS.ReadFile("presets/" + name + ".txt")
+	if err != nil {
+		return nil, err
+	}
+	var embedded []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			embedded = append(embedded, line)
+		}
+	}
+	if !PresetRefresh && len(embedded) > 0 {
+		return embedded, nil
+	}
+
+	var ranges []string
+	for _, url := range urls {
+		lines, err := fetchSource(url)
+		if err == nil {
+			lines = extractRanges(strings.Join(lines, "\n"))
+		}
+		if err == nil && len(lines) == 0 {
+			err = fmt.Errorf("未找到 IP 段数据")
+		}
+		if err != nil {
+			if len(embedded) == 0 {
+				return nil, fmt.Errorf("[%s] 暂未内置 IP 段数据，从 [%s] 获取失败: %v", name, url, err)
+			}
+			utils.LogWarn("更新内置 IP 段数据 [%s] 失败: %v，改用内置的数据", name, err)
+			return embedded, nil
+		}
+		ranges = append(ranges, lines...)
+	}
+	return ranges, nil
+}
+
+// extractRanges 从接口返回的内容中提取 IP 及 IP 段
+// JSON 格式时提取其中所有为 IP 或 IP 段的字符串（各 CDN 的字段名不同），否则按行读取
+func extractRanges(content string) []string {
+	var value any
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		var ranges []string
+		for _, line := range strings.Split(content, "\n") {
+			if line = strings.TrimSpace(line); isInlineRange(line) {
+				ranges = append(ranges, line)
+			}
+		}
+		return ranges
+	}
+
+	var ranges []string
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case string:
+			if v = strings.TrimSpace(v); isInlineRange(v) {
+				ranges = append(ranges, v)
+			}
+		case []any:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]any:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(value)
+	return ranges
+}
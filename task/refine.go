@@ -0,0 +1,90 @@
+package task
+
+import (
+	"math/rand"
+	"net"
+	"sort"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+const defaultRefineBlocks = 5
+
+var (
+	RefineSearch  bool                  // 两阶段测速：先粗测每个网段，再精测最优的网段
+	RefineBlocks  = defaultRefineBlocks // 精测的网段数量
+	RefineSamples = 0                   // 每个网段精测的 IP 数量，0 表示网段内全部 IP
+)
+
+// refineBlock 精测网段，IPv4 为 /24，IPv6 为 /120
+type refineBlock [16]byte
+
+func blockOf(ip net.IP) (block refineBlock) {
+	copy(block[:], ip.To16())
+	block[15] = 0
+	return
+}
+
+// hosts 返回网段内要精测的 IP：只选取位于 ranges 中的 IP，并经过排除列表、临时黑名单及 ASN、国家过滤，
+// RefineSamples 大于 0 时从中随机选取
+func (b refineBlock) hosts(ranges []*net.IPNet, filter *candidateFilter) []*net.IPAddr {
+	ips := make([]*net.IPAddr, 0, 256)
+	for i := 0; i < 256; i++ {
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, b[:])
+		ip[15] = byte(i)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		if containsIP(ranges, ip) {
+			ips = append(ips, &net.IPAddr{IP: ip})
+		}
+	}
+	ips = filter.filter(ips)
+	if RefineSamples > 0 && RefineSamples < len(ips) {
+		rand.Shuffle(len(ips), func(i, j int) { ips[i], ips[j] = ips[j], ips[i] })
+		ips = ips[:RefineSamples]
+	}
+	return ips
+}
+
+// Refine 两阶段测速的第二阶段：从粗测结果（已过滤并排序）中选出最优的 RefineBlocks 个网段，
+// 对网段内位于本次读取的 IP 段中的 IP 进行精测，并用精测结果替换这些网段的粗测结果
+// 未启用两阶段测速或测速全部 IP 时直接返回粗测结果
+func (p *Ping) Refine(coarse utils.PingDelaySet) utils.PingDelaySet {
+	if !RefineSearch || TestAll || len(coarse) == 0 {
+		return coarse
+	}
+	if RefineBlocks <= 0 {
+		RefineBlocks = defaultRefineBlocks
+	}
+
+	selected := make(map[refineBlock]bool)
+	filter := newCandidateFilter()
+	var ips []*net.IPAddr
+	for _, data := range coarse {
+		if len(selected) >= RefineBlocks {
+			break
+		}
+		block := blockOf(data.IP.IP)
+		if selected[block] {
+			continue
+		}
+		selected[block] = true
+		ips = append(ips, block.hosts(p.ranges, filter)...)
+	}
+	filter.report()
+	utils.LogInfo("开始精细测速（网段：%d 个，IP：%d 个）", len(selected), len(ips))
+
+	fine := newPing(ips).Run().FilterDelay().FilterLossRate().FilterTLS().FilterStats()
+
+	result := make(utils.PingDelaySet, 0, len(coarse)+len(fine))
+	for _, data := range coarse {
+		if !selected[blockOf(data.IP.IP)] {
+			result = append(result, data)
+		}
+	}
+	result = append(result, fine...)
+	sort.Sort(result)
+	return result
+}
@@ -0,0 +1,43 @@
+package task
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRefineBlockHosts(t *testing.T) {
+	origExclude, origSamples := ExcludeText, RefineSamples
+	t.Cleanup(func() { ExcludeText, RefineSamples = origExclude, origSamples })
+
+	_, half, _ := net.ParseCIDR("1.0.0.0/25")
+	_, other, _ := net.ParseCIDR("8.8.8.0/24")
+	block := blockOf(net.ParseIP("1.0.0.10"))
+
+	tests := []struct {
+		name    string
+		ranges  []*net.IPNet
+		exclude string
+		samples int
+		want    int
+	}{
+		{"只选取 IP 段内的 IP", []*net.IPNet{half}, "", 0, 128},
+		{"去除排除的 IP 段", []*net.IPNet{half}, "1.0.0.0/28", 0, 112},
+		{"随机选取", []*net.IPNet{half}, "", 10, 10},
+		{"网段不在 IP 段中", []*net.IPNet{other}, "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ExcludeText, RefineSamples = tt.exclude, tt.samples
+			filter := newCandidateFilter()
+			hosts := block.hosts(tt.ranges, filter)
+			if len(hosts) != tt.want {
+				t.Fatalf("len(hosts) = %d, want %d", len(hosts), tt.want)
+			}
+			for _, ip := range hosts {
+				if !containsIP(tt.ranges, ip.IP) || containsIP(filter.nets, ip.IP) {
+					t.Errorf("IP %s 不应被选中", ip)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package task
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+const defaultUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36"
+
+var (
+	HTTPHeaders   http.Header       // 自定义请求头，HTTP、TLS 测速及下载测速共用
+	HTTPHost      string            // 请求使用的 Host，为空时使用测速地址的域名
+	HttpingMethod = http.MethodHead // HTTP 测速使用的请求方法，HEAD 或 GET
+)
+
+// ParseHTTPHeaders 解析自定义请求头，每行一个 "名称: 值"（环境变量中可使用 \n 分隔），无效的行及 Host 会被跳过并输出警告
+func ParseHTTPHeaders(s string) http.Header {
+	header := make(http.Header)
+	for _, line := range strings.Split(strings.ReplaceAll(s, `\n`, "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") { // 跳过空行及注释
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			utils.LogWarn("跳过无效的请求头 [%s]，格式应为 \"名称: 值\"", line)
+			continue
+		}
+		if strings.EqualFold(name, "Host") { // net/http 会忽略请求头中的 Host
+			utils.LogWarn("跳过请求头 [%s]，请使用 http_host 指定 Host", line)
+			continue
+		}
+		header.Add(textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(value))
+	}
+	return header
+}
+
+// CheckHttpingMethod 检查 HTTP 测速的请求方法，只支持 HEAD 和 GET
+func CheckHttpingMethod(method string) string {
+	switch method = strings.ToUpper(strings.TrimSpace(method)); method {
+	case http.MethodHead, http.MethodGet:
+		return method
+	case "":
+		return http.MethodHead
+	default:
+		utils.LogWarn("不支持的 HTTP 测速请求方法 [%s]，将使用 HEAD", method)
+		return http.MethodHead
+	}
+}
+
+// newRequest 创建测速请求，设置默认的 User-Agent、自定义请求头及 Host
+func newRequest(method, url string) (*http.Request, error) {
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", defaultUserAgent)
+	for name, values := range HTTPHeaders {
+		request.Header[name] = append([]string(nil), values...) // 自定义请求头覆盖默认值
+	}
+	if HTTPHost != "" {
+		request.Host = HTTPHost
+	}
+	return request, nil
+}
+
+// probeTLSConfig 返回测速请求使用的 TLS 配置，指定了 SNI 时以其进行握手及证书验证
+func probeTLSConfig(insecure bool) *tls.Config {
+	if TLSSNI == "" && !insecure {
+		return nil
+	}
+	return &tls.Config{
+		ServerName:         TLSSNI,
+		InsecureSkipVerify: insecure,
+	}
+}
@@ -0,0 +1,32 @@
+package task
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseHTTPHeaders(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  http.Header
+	}{
+		{"空", "", http.Header{}},
+		{"多行", "X-Test: 1\nAccept: */*", http.Header{"X-Test": {"1"}, "Accept": {"*/*"}}},
+		{"环境变量中的 \\n", `X-Test: 1\nAccept: */*`, http.Header{"X-Test": {"1"}, "Accept": {"*/*"}}},
+		{"规范化名称并去除空白", "  x-test :  a b  ", http.Header{"X-Test": {"a b"}}},
+		{"值中包含冒号", "Referer: https://example.com/", http.Header{"Referer": {"https://example.com/"}}},
+		{"同名请求头", "X-Test: 1\nX-Test: 2", http.Header{"X-Test": {"1", "2"}}},
+		{"跳过空行及注释", "\n# X-Skip: 1\n\nX-Test: 1\n", http.Header{"X-Test": {"1"}}},
+		{"跳过无效的行", "invalid\n: empty\nBad Name: 1\nX-Test: 1", http.Header{"X-Test": {"1"}}},
+		{"跳过 Host", "Host: example.com\nhost: example.org\nX-Test: 1", http.Header{"X-Test": {"1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseHTTPHeaders(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseHTTPHeaders(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package task
+
+import (
+	"math/big"
+	"math/rand"
+	"net"
+	"sort"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+const (
+	defaultSamplesPerPrefix    = 1
+	defaultIPv4SamplePrefixLen = 24
+	maxRangeCandidates         = 1 << 20 // 单个 IP 段的候选 IP 数量上限，避免 IPv6 大段按小前缀采样时耗尽内存
+)
+
+var (
+	SamplesPerPrefix    = defaultSamplesPerPrefix    // 每个采样前缀随机测速的 IP 数量
+	IPv4SamplePrefixLen = defaultIPv4SamplePrefixLen // IPv4 采样前缀长度
+	IPv6SamplePrefixLen = 0                          // IPv6 采样前缀长度，0 表示随机游走采样
+	MaxCandidates       = 0                          // 候选 IP 总数上限，0 表示不限制
+)
+
+// candidateRange 一个 IP 段的候选 IP 数量及生成方式
+type candidateRange struct {
+	count    int                           // 候选 IP 数量
+	generate func(quota int) []*net.IPAddr // 生成 quota 个候选 IP（quota 不超过 count）
+}
+
+func checkSampleDefault() {
+	if SamplesPerPrefix <= 0 {
+		SamplesPerPrefix = defaultSamplesPerPrefix
+	}
+	if IPv4SamplePrefixLen <= 0 || IPv4SamplePrefixLen > 32 {
+		IPv4SamplePrefixLen = defaultIPv4SamplePrefixLen
+	}
+	if IPv6SamplePrefixLen < 0 || IPv6SamplePrefixLen > 128 {
+		IPv6SamplePrefixLen = 0
+	}
+}
+
+// candidates 返回当前 IP 段（parseCIDR 的结果）的候选 IP
+// 测速全部 IPv4 及 IPv6 随机游走采样沿用原有的生成方式，其余按采样前缀生成
+func (r *IPRanges) candidates(isIPv4 bool) candidateRange {
+	checkSampleDefault()
+	if (isIPv4 && TestAll) || (!isIPv4 && IPv6SamplePrefixLen == 0) {
+		r.ips = r.ips[:0]
+		if isIPv4 {
+			r.chooseIPv4()
+		} else {
+			r.chooseIPv6()
+		}
+		ips := append([]*net.IPAddr(nil), r.ips...)
+		return candidateRange{
+			count: len(ips),
+			generate: func(quota int) []*net.IPAddr {
+				if quota < len(ips) {
+					rand.Shuffle(len(ips), func(i, j int) { ips[i], ips[j] = ips[j], ips[i] })
+					return ips[:quota]
+				}
+				return ips
+			},
+		}
+	}
+
+	prefixLen := IPv6SamplePrefixLen
+	if isIPv4 {
+		prefixLen = IPv4SamplePrefixLen
+	}
+	return newPrefixSampler(r.ipNet, prefixLen).candidateRange()
+}
+
+// prefixSampler 将 IP 段划分为若干采样前缀，每个前缀随机选取 SamplesPerPrefix 个 IP
+type prefixSampler struct {
+	base      *big.Int // IP 段的第一个地址
+	isIPv4    bool
+	prefixes  *big.Int // 采样前缀数量
+	hostBits  int      // 采样前缀内的主机位数
+	perPrefix int      // 每个采样前缀选取的 IP 数量
+}
+
+func newPrefixSampler(ipNet *net.IPNet, prefixLen int) *prefixSampler {
+	ones, bits := ipNet.Mask.Size()
+	prefixLen = min(max(prefixLen, ones), bits) // 采样前缀不能大于 IP 段本身，也不能超过地址长度
+	ip := ipNet.IP.To4()
+	if ip == nil {
+		ip = ipNet.IP.To16()
+	}
+	s := &prefixSampler{
+		base:     new(big.Int).SetBytes(ip),
+		isIPv4:   bits == 32,
+		prefixes: new(big.Int).Lsh(big.NewInt(1), uint(prefixLen-ones)),
+		hostBits: bits - prefixLen,
+	}
+	s.perPrefix = SamplesPerPrefix
+	if s.hostBits < 31 && s.perPrefix > 1<<s.hostBits {
+		s.perPrefix = 1 << s.hostBits
+	}
+	return s
+}
+
+func (s *prefixSampler) candidateRange() candidateRange {
+	total := new(big.Int).Mul(s.prefixes, big.NewInt(int64(s.perPrefix)))
+	count := maxRangeCandidates
+	if total.IsInt64() && total.Int64() <= maxRangeCandidates {
+		count = int(total.Int64())
+	} else {
+		utils.LogWarn("IP 段 %s 按当前采样设置有 %s 个候选 IP，只采样其中 %d 个", s.ip(s.base), total.String(), maxRangeCandidates)
+	}
+	return candidateRange{count: count, generate: s.generate}
+}
+
+// generate 从均匀分布在 IP 段内的采样前缀中生成 quota 个 IP
+func (s *prefixSampler) generate(quota int) []*net.IPAddr {
+	if quota <= 0 {
+		return nil
+	}
+	// 需要的采样前缀数量，在 IP 段内等距选取，并在每个间隔内随机偏移
+	need := big.NewInt(int64((quota + s.perPrefix - 1) / s.perPrefix))
+	if need.Cmp(s.prefixes) > 0 {
+		need.Set(s.prefixes)
+	}
+	stride := new(big.Int).Div(s.prefixes, need)
+
+	ips := make([]*net.IPAddr, 0, quota)
+	index := new(big.Int)
+	for i := int64(0); i < need.Int64() && len(ips) < quota; i++ {
+		index.Mul(big.NewInt(i), s.prefixes)
+		index.Div(index, need)
+		index.Add(index, randBelow(stride))
+		prefix := new(big.Int).Lsh(index, uint(s.hostBits))
+		prefix.Add(prefix, s.base)
+		for _, host := range s.randomHosts(min(s.perPrefix, quota-len(ips))) {
+			ips = append(ips, &net.IPAddr{IP: s.ip(new(big.Int).Add(prefix, host))})
+		}
+	}
+	return ips
+}
+
+// randomHosts 在采样前缀内随机选取 n 个不重复的主机号
+func (s *prefixSampler) randomHosts(n int) []*big.Int {
+	if s.hostBits < 12 { // 主机数量较少时直接打乱选取
+		hosts := make([]*big.Int, 0, n)
+		for _, v := range rand.Perm(1 << s.hostBits)[:n] {
+			hosts = append(hosts, big.NewInt(int64(v)))
+		}
+		return hosts
+	}
+	size := new(big.Int).Lsh(big.NewInt(1), uint(s.hostBits))
+	seen := make(map[string]bool, n)
+	hosts := make([]*big.Int, 0, n)
+	for len(hosts) < n {
+		host := randBelow(size)
+		if key := host.String(); !seen[key] {
+			seen[key] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// ip 将整数转换为 IP 地址
+func (s *prefixSampler) ip(v *big.Int) net.IP {
+	size := net.IPv6len
+	if s.isIPv4 {
+		size = net.IPv4len
+	}
+	return net.IP(v.FillBytes(make([]byte, size)))
+}
+
+// randBelow 返回 [0, n) 内的随机整数
+func randBelow(n *big.Int) *big.Int {
+	if n.Sign() <= 0 {
+		return new(big.Int)
+	}
+	if n.IsInt64() {
+		return big.NewInt(rand.Int63n(n.Int64()))
+	}
+	v := new(big.Int)
+	for i := 0; i < n.BitLen(); i += 63 {
+		v.Lsh(v, 63)
+		v.Or(v, big.NewInt(rand.Int63()))
+	}
+	return v.Mod(v, n)
+}
+
+// generateFiltered 生成 quota 个通过过滤的候选 IP，过滤后不足时加倍生成，直到满足数量或已生成 IP 段内全部候选 IP
+func (r candidateRange) generateFiltered(quota int, filter *candidateFilter) []*net.IPAddr {
+	excluded, mismatched := filter.excluded, filter.mismatched
+	for n := min(r.count, quota); ; n = min(r.count, n*2) {
+		filter.excluded, filter.mismatched = excluded, mismatched // 只统计最后一次生成的结果
+		ips := filter.filter(r.generate(n))
+		if len(ips) >= quota || n >= r.count || n <= 0 {
+			return ips[:min(len(ips), quota)]
+		}
+	}
+}
+
+// sampleCandidates 生成全部候选 IP 并过滤，过滤后超过 MaxCandidates 时在各 IP 段之间平均分配数量
+func sampleCandidates(ranges []candidateRange, filter *candidateFilter) []*net.IPAddr {
+	total := 0
+	for _, r := range ranges {
+		total += r.count
+	}
+	result := make([][]*net.IPAddr, len(ranges))
+	if MaxCandidates > 0 && total > MaxCandidates {
+		// 候选 IP 较少的 IP 段全部保留，剩余数量由其余 IP 段平分，过滤后不足的数量顺延给之后的 IP 段
+		order := make([]int, len(ranges))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool { return ranges[order[a]].count < ranges[order[b]].count })
+		remaining := MaxCandidates
+		for n, i := range order {
+			share := remaining / (len(order) - n)
+			result[i] = ranges[i].generateFiltered(share, filter)
+			remaining -= len(result[i])
+		}
+		utils.LogInfo("候选 IP 数量 [%d] 超过上限 [%d]，已在 %d 个 IP 段之间平均分配", total, MaxCandidates, len(ranges))
+	} else {
+		for i, r := range ranges {
+			result[i] = filter.filter(r.generate(r.count))
+		}
+	}
+
+	var ips []*net.IPAddr
+	for _, r := range result {
+		ips = append(ips, r...)
+	}
+	return ips
+}
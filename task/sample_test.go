@@ -0,0 +1,150 @@
+//go:debug randseednop=0
+
+package task
+
+import (
+	"math/rand"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// setSampleTest 设置采样参数并固定随机数种子，测试结束后恢复
+func setSampleTest(t *testing.T, perPrefix, maxCandidates int) {
+	t.Helper()
+	origPerPrefix, origMax, origExclude := SamplesPerPrefix, MaxCandidates, ExcludeText
+	SamplesPerPrefix, MaxCandidates, ExcludeText = perPrefix, maxCandidates, ""
+	rand.Seed(1) // Go 1.24 起 rand.Seed 默认无效，需要文件开头的 randseednop=0
+	t.Cleanup(func() {
+		SamplesPerPrefix, MaxCandidates, ExcludeText = origPerPrefix, origMax, origExclude
+	})
+}
+
+func mustParseCIDR(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ipNet
+}
+
+func TestPrefixSampler(t *testing.T) {
+	tests := []struct {
+		name       string
+		cidr       string
+		prefixLen  int
+		perPrefix  int
+		quota      int
+		wantCount  int
+		samplePref int // 检查每个采样前缀内 IP 数量时使用的前缀长度
+	}{
+		{"IPv4 按 /24 采样", "10.0.0.0/22", 24, 2, 8, 8, 24},
+		{"IPv4 只采样部分前缀", "10.0.0.0/16", 24, 1, 10, 256, 24},
+		{"IPv4 采样前缀不能大于 IP 段", "10.0.0.0/28", 24, 3, 3, 3, 28},
+		{"IPv4 每个前缀的数量不超过主机数量", "10.0.0.0/31", 32, 5, 2, 2, 32},
+		{"IPv6 按 /48 采样", "2001:db8::/32", 48, 1, 100, 65536, 48},
+		{"IPv6 每个 /64 采样多个 IP", "2001:db8::/60", 64, 4, 64, 64, 64},
+		{"IPv6 候选数量上限", "2001:db8::/32", 64, 1, 50, maxRangeCandidates, 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setSampleTest(t, tt.perPrefix, 0)
+			ipNet := mustParseCIDR(t, tt.cidr)
+			r := newPrefixSampler(ipNet, tt.prefixLen).candidateRange()
+			if r.count != tt.wantCount {
+				t.Fatalf("count = %d, want %d", r.count, tt.wantCount)
+			}
+
+			ips := r.generate(tt.quota)
+			if len(ips) != tt.quota {
+				t.Fatalf("len(generate(%d)) = %d", tt.quota, len(ips))
+			}
+			_, bits := ipNet.Mask.Size()
+			seen := make(map[string]bool)
+			perPrefix := make(map[string]int)
+			for _, ip := range ips {
+				if !ipNet.Contains(ip.IP) {
+					t.Errorf("IP %s 不在 %s 内", ip, tt.cidr)
+				}
+				if (bits == 32) != (ip.IP.To4() != nil) {
+					t.Errorf("IP %s 的地址族与 %s 不同", ip, tt.cidr)
+				}
+				if seen[ip.String()] {
+					t.Errorf("IP %s 重复", ip)
+				}
+				seen[ip.String()] = true
+				prefix := ip.IP.Mask(net.CIDRMask(tt.samplePref, bits)).String()
+				perPrefix[prefix]++
+			}
+			limit := min(tt.perPrefix, 1<<min(bits-tt.samplePref, 30))
+			for prefix, n := range perPrefix {
+				if n > limit {
+					t.Errorf("采样前缀 %s 内有 %d 个 IP, want <= %d", prefix, n, limit)
+				}
+			}
+		})
+	}
+}
+
+func TestPrefixSamplerDeterministic(t *testing.T) {
+	ipNet := mustParseCIDR(t, "2001:db8::/32")
+	generate := func() []*net.IPAddr {
+		setSampleTest(t, 2, 0)
+		return newPrefixSampler(ipNet, 48).generate(20)
+	}
+	if first, second := generate(), generate(); !reflect.DeepEqual(first, second) {
+		t.Errorf("相同的随机数种子生成了不同的 IP: %v, %v", first, second)
+	}
+}
+
+func TestSampleCandidates(t *testing.T) {
+	cidrs := []string{"10.0.0.0/28", "10.1.0.0/16", "10.2.0.0/16"} // 候选 IP 数量分别为 16、256、256（按 /24 采样时每个 /24 一个）
+	tests := []struct {
+		name          string
+		prefixLen     int
+		maxCandidates int
+		exclude       string
+		wantTotal     int
+		wantPerRange  []int
+	}{
+		{"不限制数量", 24, 0, "", 1 + 256 + 256, []int{1, 256, 256}},
+		{"全部 IP", 32, 0, "", 16 + 65536*2, []int{16, 65536, 65536}},
+		{"平均分配数量", 32, 300, "", 300, []int{16, 142, 142}},
+		{"少于上限时全部保留", 32, 200000, "", 16 + 65536*2, []int{16, 65536, 65536}},
+		{"排除后不足的数量顺延", 32, 300, "10.0.0.0/29", 300, []int{8, 146, 146}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setSampleTest(t, 1, tt.maxCandidates)
+			ExcludeText = tt.exclude
+			var ranges []candidateRange
+			var nets []*net.IPNet
+			for _, cidr := range cidrs {
+				ipNet := mustParseCIDR(t, cidr)
+				nets = append(nets, ipNet)
+				ranges = append(ranges, newPrefixSampler(ipNet, tt.prefixLen).candidateRange())
+			}
+
+			filter := newCandidateFilter()
+			ips := sampleCandidates(ranges, filter)
+			if len(ips) != tt.wantTotal {
+				t.Fatalf("len(ips) = %d, want %d", len(ips), tt.wantTotal)
+			}
+			counts := make([]int, len(nets))
+			for _, ip := range ips {
+				if containsIP(filter.nets, ip.IP) {
+					t.Errorf("IP %s 应被排除", ip)
+				}
+				for i, ipNet := range nets {
+					if ipNet.Contains(ip.IP) {
+						counts[i]++
+					}
+				}
+			}
+			if !reflect.DeepEqual(counts, tt.wantPerRange) {
+				t.Errorf("各 IP 段的数量 = %v, want %v", counts, tt.wantPerRange)
+			}
+		})
+	}
+}
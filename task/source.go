@@ -0,0 +1,224 @@
+package task
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+const (
+	defaultIPCacheDir  = "ip_cache"
+	sourceFetchTimeout = time.Second * 10
+	inlineSourceName   = "inline"
+)
+
+var IPCacheDir = defaultIPCacheDir // 远程 IP 段数据的缓存目录，为空时不缓存
+
+var sourceClient = &http.Client{Timeout: sourceFetchTimeout}
+
+// ipSource 一个 IP 段数据来源及其内容
+type ipSource struct {
+	name   string // 文件名、URL、preset:名称、ip_text 或 inline（直接填写的 IP 段）
+	lines  []string
+	family string // 只保留该地址族（"IPv4" 或 "IPv6"）的 IP 段，为空时根据当前模式决定
+}
+
+// sourceCacheMeta 远程 IP 段数据缓存的校验信息
+type sourceCacheMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// splitSources 将英文逗号分隔的数据来源拆分为列表
+func splitSources(s string) []string {
+	var sources []string
+	for _, source := range strings.Split(s, ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// isInlineRange 判断数据来源是否为直接填写的 IP 或 IP 段
+func isInlineRange(source string) bool {
+	if _, _, err := net.ParseCIDR(source); err == nil {
+		return true
+	}
+	return net.ParseIP(source) != nil
+}
+
+// readSources 依次读取多个数据来源（文件路径、URL、内置 IP 段数据或直接填写的 IP 段），读取失败的来源会被跳过
+// 所有来源均读取失败时返回错误
+func readSources(list string) ([]ipSource, error) {
+	var sources []ipSource
+	var inline []string
+	var failed []string
+	for _, name := range splitSources(list) {
+		if isInlineRange(name) {
+			inline = append(inline, name)
+			continue
+		}
+		lines, err := readSource(name)
+		if err != nil {
+			utils.LogError("读取 IP 段数据 [%s] 失败: %v", name, err)
+			failed = append(failed, name)
+			continue
+		}
+		sources = append(sources, ipSource{name: name, lines: lines})
+	}
+	if len(inline) > 0 {
+		sources = append(sources, ipSource{name: inlineSourceName, lines: inline})
+	}
+	if len(sources) == 0 && len(failed) > 0 {
+		return nil, fmt.Errorf("所有数据来源均读取失败: %s", strings.Join(failed, ", "))
+	}
+	return sources, nil
+}
+
+// readSource 读取单个文件、URL 或内置 IP 段数据的内容
+func readSource(name string) ([]string, error) {
+	if isPreset(name) {
+		return readPreset(name)
+	}
+	if isURL(name) {
+		return fetchSource(name)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			if utils.Debug {
+				utils.LogError("Error closing file: %v", err)
+			}
+		}
+	}(file)
+	return readLines(file)
+}
+
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// sourceCachePath 返回 URL 对应的缓存文件及校验信息文件路径
+func sourceCachePath(url string) (data, meta string) {
+	sum := sha1.Sum([]byte(url))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(IPCacheDir, name+".txt"), filepath.Join(IPCacheDir, name+".json")
+}
+
+// fetchSource 下载远程 IP 段数据，并使用 ETag / If-Modified-Since 条件请求更新磁盘缓存
+// URL 无法访问或返回错误状态码时使用缓存的数据
+func fetchSource(url string) ([]string, error) {
+	lines, err := fetchWithCache(url)
+	if err == nil {
+		return lines, nil
+	}
+	if IPCacheDir == "" {
+		return nil, err
+	}
+	dataPath, _ := sourceCachePath(url)
+	file, cacheErr := os.Open(dataPath)
+	if cacheErr != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+	utils.LogWarn("下载 IP 段数据 [%s] 失败: %v，改用缓存的数据", url, err)
+	return readLines(file)
+}
+
+func fetchWithCache(url string) ([]string, error) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var dataPath, metaPath string
+	var meta sourceCacheMeta
+	if IPCacheDir != "" {
+		dataPath, metaPath = sourceCachePath(url)
+		if content, err := os.ReadFile(metaPath); err == nil && json.Unmarshal(content, &meta) == nil {
+			if _, err := os.Stat(dataPath); err == nil { // 只有缓存数据存在时才发送条件请求
+				if meta.ETag != "" {
+					request.Header.Set("If-None-Match", meta.ETag)
+				}
+				if meta.LastModified != "" {
+					request.Header.Set("If-Modified-Since", meta.LastModified)
+				}
+			}
+		}
+	}
+
+	response, err := sourceClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			if utils.Debug {
+				utils.LogError("Error closing response body: %v", err)
+			}
+		}
+	}(response.Body)
+
+	if response.StatusCode == http.StatusNotModified && dataPath != "" {
+		if utils.Debug { // 调试模式下，输出更多信息
+			utils.LogDebug("IP 段数据 [%s] 未变化，使用缓存的数据", url)
+		}
+		content, err := os.ReadFile(dataPath)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Split(string(content), "\n"), nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP 状态码: %d", response.StatusCode)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if dataPath != "" {
+		meta = sourceCacheMeta{URL: url, ETag: response.Header.Get("ETag"), LastModified: response.Header.Get("Last-Modified")}
+		if err := writeSourceCache(dataPath, metaPath, body, meta); err != nil {
+			utils.LogWarn("缓存 IP 段数据 [%s] 失败: %v", url, err)
+		}
+	}
+	return strings.Split(string(body), "\n"), nil
+}
+
+func writeSourceCache(dataPath, metaPath string, body []byte, meta sourceCacheMeta) error {
+	if err := os.MkdirAll(IPCacheDir, 0o755); err != nil {
+		return err
+	}
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return errors.Join(os.WriteFile(dataPath, body, 0o644), os.WriteFile(metaPath, content, 0o644))
+}
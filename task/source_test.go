@@ -0,0 +1,133 @@
+package task
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+const sourceTestBody = "1.1.1.0/24\n2606:4700::/32"
+
+// startSourceServer 启动本地 IP 段数据服务器，status 为之后的请求返回的状态码，
+// 返回 200 时带有 ETag 及 Last-Modified，请求带有匹配的校验信息时返回 304
+func startSourceServer(t *testing.T, status *atomic.Int32, conditional *atomic.Int32) *httptest.Server {
+	t.Helper()
+	const etag, lastModified = `"v1"`, "Mon, 01 Jan 2024 00:00:00 GMT"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastModified {
+			conditional.Add(1)
+			if status.Load() == http.StatusOK {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		if code := int(status.Load()); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		_, _ = w.Write([]byte(sourceTestBody))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// setSourceCacheTest 设置缓存目录，测试结束后恢复
+func setSourceCacheTest(t *testing.T, dir string) {
+	t.Helper()
+	origDir := IPCacheDir
+	IPCacheDir = dir
+	t.Cleanup(func() { IPCacheDir = origDir })
+}
+
+func TestFetchSourceCache(t *testing.T) {
+	setSourceCacheTest(t, t.TempDir())
+	var status, conditional atomic.Int32
+	status.Store(http.StatusOK)
+	server := startSourceServer(t, &status, &conditional)
+	url := server.URL + "/ips"
+	want := []string{"1.1.1.0/24", "2606:4700::/32"}
+
+	// 200：返回数据并写入缓存
+	lines, err := fetchSource(url)
+	if err != nil {
+		t.Fatalf("200: %v", err)
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("200: lines = %v, want %v", lines, want)
+	}
+	if conditional.Load() != 0 {
+		t.Error("200: 没有缓存时不应发送条件请求")
+	}
+	dataPath, metaPath := sourceCachePath(url)
+	if content, err := os.ReadFile(dataPath); err != nil || string(content) != sourceTestBody {
+		t.Fatalf("缓存数据 = %q, %v", content, err)
+	}
+	if _, err := os.Stat(metaPath); err != nil {
+		t.Fatalf("缓存校验信息: %v", err)
+	}
+
+	// 304：使用缓存的数据
+	lines, err = fetchSource(url)
+	if err != nil {
+		t.Fatalf("304: %v", err)
+	}
+	if conditional.Load() != 1 {
+		t.Errorf("304: 条件请求 %d 次, want 1", conditional.Load())
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("304: lines = %v, want %v", lines, want)
+	}
+
+	// 500：使用缓存的数据
+	status.Store(http.StatusInternalServerError)
+	if _, err := fetchWithCache(url); err == nil {
+		t.Error("500: fetchWithCache() error = nil, want error")
+	}
+	lines, err = fetchSource(url)
+	if err != nil {
+		t.Fatalf("500: %v", err)
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("500: lines = %v, want %v", lines, want)
+	}
+
+	// 服务器无法访问：使用缓存的数据
+	server.Close()
+	lines, err = fetchSource(url)
+	if err != nil {
+		t.Fatalf("无法访问: %v", err)
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("无法访问: lines = %v, want %v", lines, want)
+	}
+}
+
+func TestFetchSourceWithoutCache(t *testing.T) {
+	var status, conditional atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	server := startSourceServer(t, &status, &conditional)
+	url := server.URL + "/ips"
+
+	// 有缓存但未开启缓存时，不使用缓存的数据
+	setSourceCacheTest(t, t.TempDir())
+	status.Store(http.StatusOK)
+	if _, err := fetchSource(url); err != nil {
+		t.Fatal(err)
+	}
+	status.Store(http.StatusInternalServerError)
+	IPCacheDir = ""
+	if lines, err := fetchSource(url); err == nil {
+		t.Errorf("未开启缓存时 fetchSource() = %v, want error", lines)
+	}
+
+	// 开启缓存但没有缓存的数据时返回错误
+	IPCacheDir = t.TempDir()
+	if lines, err := fetchSource(url); err == nil {
+		t.Errorf("没有缓存时 fetchSource() = %v, want error", lines)
+	}
+}
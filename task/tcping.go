@@ -29,6 +29,7 @@ type Ping struct {
 	wg      *sync.WaitGroup
 	m       *sync.Mutex
 	ips     []*net.IPAddr
+	ranges  []*net.IPNet // 生成 ips 的 IP 段，精细测速只在其中选取 IP
 	csv     utils.PingDelaySet
 	control chan bool
 	bar     *utils.Bar
@@ -47,8 +48,16 @@ func checkPingDefault() {
 }
 
 func NewPing() *Ping {
+	ips, ranges := loadIPRanges()
+	ping := newPing(ips)
+	ping.ranges = ranges
+	return ping
+}
+
+// newPing 对指定的 IP 列表进行延迟测速
+func newPing(ips []*net.IPAddr) *Ping {
 	checkPingDefault()
-	ips := loadIPRanges()
+	checkAdaptiveDefault()
 	return &Ping{
 		wg:      &sync.WaitGroup{},
 		m:       &sync.Mutex{},
@@ -63,8 +72,14 @@ func (p *Ping) Run() utils.PingDelaySet {
 	if len(p.ips) == 0 {
 		return p.csv
 	}
-	if Httping {
+	if Httping && HTTP3 {
+		utils.LogInfo("开始延迟测速（模式：HTTP/3, 端口：%d, 范围：%v ~ %v ms, 丢包：%.2f）", TCPPort, utils.InputMinDelay.Milliseconds(), utils.InputMaxDelay.Milliseconds(), utils.InputMaxLossRate)
+	} else if Httping {
 		utils.LogInfo("开始延迟测速（模式：HTTP, 端口：%d, 范围：%v ~ %v ms, 丢包：%.2f）", TCPPort, utils.InputMinDelay.Milliseconds(), utils.InputMaxDelay.Milliseconds(), utils.InputMaxLossRate)
+	} else if TLSPing {
+		utils.LogInfo("开始延迟测速（模式：TLS, 端口：%d, 范围：%v ~ %v ms, 丢包：%.2f）", TCPPort, utils.InputMinDelay.Milliseconds(), utils.InputMaxDelay.Milliseconds(), utils.InputMaxLossRate)
+	} else if ICMPing {
+		utils.LogInfo("开始延迟测速（模式：ICMP, 范围：%v ~ %v ms, 丢包：%.2f）", utils.InputMinDelay.Milliseconds(), utils.InputMaxDelay.Milliseconds(), utils.InputMaxLossRate)
 	} else {
 		utils.LogInfo("开始延迟测速（模式：TCP, 端口：%d, 范围：%v ~ %v ms, 丢包：%.2f）", TCPPort, utils.InputMinDelay.Milliseconds(), utils.InputMaxDelay.Milliseconds(), utils.InputMaxLossRate)
 	}
@@ -110,17 +125,33 @@ func (p *Ping) tcping(ip *net.IPAddr) (bool, time.Duration) {
 	return true, duration
 }
 
-// pingReceived pingTotalTime
-func (p *Ping) checkConnection(ip *net.IPAddr) (received int, totalDelay time.Duration, colo string) {
+// 返回发送次数及每次成功测速的延迟样本
+func (p *Ping) checkConnection(ip *net.IPAddr) (transmitted int, delays []time.Duration, colo string, phases tlsPhases) {
 	if Httping {
-		received, totalDelay, colo = p.httping(ip)
+		transmitted, delays, colo = p.httping(ip)
 		return
 	}
-	colo = "" // TCPing 不获取 colo
-	for i := 0; i < PingTimes; i++ {
-		if ok, delay := p.tcping(ip); ok {
-			received++
-			totalDelay += delay
+	if TLSPing {
+		return p.tlsping(ip)
+	}
+	if ICMPing {
+		transmitted, delays = p.icmping(ip)
+	} else {
+		transmitted, delays = runProbes(func(int) (time.Duration, error) {
+			if ok, delay := p.tcping(ip); ok {
+				return delay, nil
+			}
+			return 0, errProbeFailed
+		})
+	}
+	// TCPing 和 ICMPing 本身无法获取地区码，指定了地区时连通后额外请求一次获取并匹配
+	// 未指定地区时只在测速完成后为最终结果获取地区码（见 lookupResultColos），避免为每个连通的 IP 额外发送请求
+	if len(delays) > 0 && HttpingCFColo != "" {
+		if colo = p.filterColo(lookupColo(ip)); colo == "" { // 没有匹配到地区码或不符合指定地区则丢弃该 IP
+			if utils.Debug { // 调试模式下，输出更多信息
+				utils.LogError("IP: %s, 地区码不匹配", ip.String())
+			}
+			delays = nil
 		}
 	}
 	return
@@ -136,7 +167,8 @@ func (p *Ping) appendIPData(data *utils.PingData) {
 
 // handle tcping
 func (p *Ping) tcpingHandler(ip *net.IPAddr) {
-	received, totalDelay, colo := p.checkConnection(ip)
+	transmitted, delays, colo, phases := p.checkConnection(ip)
+	received := len(delays)
 	nowAble := len(p.csv)
 	if received != 0 {
 		nowAble++
@@ -147,10 +179,14 @@ func (p *Ping) tcpingHandler(ip *net.IPAddr) {
 	}
 	data := &utils.PingData{
 		IP:          ip,
-		Transmitted: PingTimes,
+		Transmitted: transmitted,
 		Received:    received,
-		Delay:       totalDelay / time.Duration(received),
 		Colo:        colo,
+		ConnectTime: phases.connect / time.Duration(received),
+		TLSTime:     phases.handshake / time.Duration(received),
+		TTFB:        phases.ttfb / time.Duration(received),
 	}
+	data.SetSamples(delays) // 计算平均延迟及延迟统计数据
+	setGeo(data)            // 查询 ASN 及地理位置
 	p.appendIPData(data)
 }
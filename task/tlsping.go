@@ -0,0 +1,133 @@
+package task
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+const tlsHandshakeTimeout = time.Second * 2
+
+var (
+	TLSPing bool
+	TLSSNI  string // TLS 握手使用的 SNI，为空时使用测速地址的域名
+)
+
+// tlsPhases TLS 测速各阶段的耗时
+type tlsPhases struct {
+	connect   time.Duration // TCP 连接耗时
+	handshake time.Duration // TLS 握手耗时
+	ttfb      time.Duration // 发送请求到收到响应首字节的耗时
+}
+
+func (t *tlsPhases) add(other tlsPhases) {
+	t.connect += other.connect
+	t.handshake += other.handshake
+	t.ttfb += other.ttfb
+}
+
+// 返回发送次数及每次成功测速的延迟样本，延迟为 TCP 连接与 TLS 握手耗时之和，即客户端建立安全连接所需的时间
+func (p *Ping) tlsping(ip *net.IPAddr) (transmitted int, delays []time.Duration, colo string, total tlsPhases) {
+	target, err := url.Parse(URL)
+	if err != nil {
+		if utils.Debug { // 调试模式下，输出更多信息
+			utils.LogError("IP: %s, 解析测速地址失败，错误信息: %v, 测速地址: %s", ip.String(), err, URL)
+		}
+		return
+	}
+	sni := TLSSNI
+	if sni == "" {
+		sni = target.Hostname()
+	}
+
+	coloChecked := false
+
+	transmitted, delays = runProbes(func(int) (time.Duration, error) {
+		phases, header, err := tlsProbe(ip, sni, target)
+		if err != nil {
+			if utils.Debug { // 调试模式下，输出更多信息
+				utils.LogError("IP: %s, TLS 测速失败，错误信息: %v, SNI: %s", ip.String(), err, sni)
+			}
+			return 0, err
+		}
+		if !coloChecked { // 通过首次成功的响应获取地区码
+			coloChecked = true
+			colo = getHeaderColo(header)
+			// 只有指定了地区才匹配机场地区码
+			if HttpingCFColo != "" {
+				if colo = p.filterColo(colo); colo == "" { // 没有匹配到地区码或不符合指定地区则直接结束该 IP 测试
+					if utils.Debug { // 调试模式下，输出更多信息
+						utils.LogError("IP: %s, 地区码不匹配", ip.String())
+					}
+					return 0, errProbeAborted
+				}
+			}
+		}
+		total.add(phases)
+		return phases.connect + phases.handshake, nil
+	})
+	return
+}
+
+// tlsProbe 通过指定 IP 建立一次 TLS 连接并发送 HEAD 请求，分别记录 TCP 连接、TLS 握手及首字节耗时
+func tlsProbe(ip *net.IPAddr, sni string, target *url.URL) (phases tlsPhases, header http.Header, err error) {
+	var fullAddress string
+	if IsIPv4(ip.String()) {
+		fullAddress = fmt.Sprintf("%s:%d", ip.String(), TCPPort)
+	} else {
+		fullAddress = fmt.Sprintf("[%s]:%d", ip.String(), TCPPort)
+	}
+
+	startTime := time.Now()
+	rawConn, err := net.DialTimeout("tcp", fullAddress, tcpConnectTimeout)
+	if err != nil {
+		return phases, nil, err
+	}
+	phases.connect = time.Since(startTime)
+
+	conn := tls.Client(rawConn, &tls.Config{
+		ServerName:         sni,
+		InsecureSkipVerify: true, // 只测量握手耗时，不验证证书
+		NextProtos:         []string{"http/1.1"},
+	})
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+	if err = conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout)); err != nil {
+		return phases, nil, err
+	}
+
+	handshakeStart := time.Now()
+	if err = conn.Handshake(); err != nil {
+		return phases, nil, err
+	}
+	phases.handshake = time.Since(handshakeStart)
+
+	request, err := newRequest(http.MethodHead, target.String())
+	if err != nil {
+		return phases, nil, err
+	}
+	request.Close = true // 每次测速使用新的连接
+	requestStart := time.Now()
+	if err = request.Write(conn); err != nil {
+		return phases, nil, err
+	}
+	reader := bufio.NewReader(conn)
+	if _, err = reader.Peek(1); err != nil {
+		return phases, nil, err
+	}
+	phases.ttfb = time.Since(requestStart)
+
+	response, err := http.ReadResponse(reader, &http.Request{Method: http.MethodHead})
+	if err != nil {
+		return phases, nil, err
+	}
+	_ = response.Body.Close()
+	return phases, response.Header, nil
+}
@@ -0,0 +1,175 @@
+package task
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+const (
+	defaultUploadSize     = 10 // 单位 MB
+	uploadChunkSize       = 64 * 1024
+	defaultMinUploadSpeed = 0.0
+	uploadContentType     = "application/octet-stream"
+	maxUploadRespBytes    = 64 * 1024
+)
+
+var (
+	UploadURL      string                         // 上传测速地址，为空时不进行上传测速
+	UploadSize     int64  = defaultUploadSize     // 上传数据量，单位 MB
+	MinUploadSpeed        = defaultMinUploadSpeed // 上传速度下限，单位 MB/s
+)
+
+func checkUploadDefault() {
+	if UploadSize <= 0 {
+		UploadSize = defaultUploadSize
+	}
+	if MinUploadSpeed < 0 {
+		MinUploadSpeed = defaultMinUploadSpeed
+	}
+}
+
+// uploadBody 生成指定大小的上传数据，并记录已发送的数据量及开始发送的时间
+type uploadBody struct {
+	chunk     []byte
+	remaining int64
+	sent      atomic.Int64
+	started   atomic.Int64 // 首次读取的时间（UnixNano），排除建立连接及 TLS 握手的耗时
+}
+
+func newUploadBody(size int64) *uploadBody {
+	chunk := make([]byte, uploadChunkSize)
+	_, _ = rand.Read(chunk) // 随机数据，避免被中间设备压缩
+	return &uploadBody{chunk: chunk, remaining: size}
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.EOF
+	}
+	b.started.CompareAndSwap(0, time.Now().UnixNano())
+	n := copy(p, b.chunk[:min(int64(len(b.chunk)), b.remaining)])
+	b.remaining -= int64(n)
+	b.sent.Add(int64(n))
+	return n, nil
+}
+
+func (b *uploadBody) Close() error {
+	return nil
+}
+
+// speed 返回平均上传速度（字节/秒）
+func (b *uploadBody) speed() float64 {
+	started := b.started.Load()
+	if started == 0 {
+		return 0
+	}
+	elapsed := time.Since(time.Unix(0, started)).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(b.sent.Load()) / elapsed
+}
+
+// TestUploadSpeed 对下载测速后的 IP 进行上传测速，未指定上传测速地址或禁用下载测速时直接返回
+// 与下载测速相同，未指定上传速度下限时只测速前 TestCount 个 IP，否则一直测速直到凑够满足条件的 IP 或全部测速完
+func TestUploadSpeed(speedSet utils.DownloadSpeedSet) utils.DownloadSpeedSet {
+	if UploadURL == "" || Disable || len(speedSet) == 0 {
+		return speedSet
+	}
+	checkUploadDefault()
+	testNum := TestCount
+	if len(speedSet) < testNum || MinUploadSpeed > 0 {
+		testNum = len(speedSet)
+	}
+	count := min(TestCount, testNum)
+
+	utils.LogInfo("开始上传测速（下限：%.2f MB/s, 数量：%d, 队列：%d, 数据量：%d MB）", MinUploadSpeed, count, testNum, UploadSize)
+	// 控制 上传测速进度条 与 延迟测速进度条 长度一致（强迫症）
+	barB := "     "
+	for i := 0; i < len(strconv.Itoa(len(speedSet))); i++ {
+		barB += " "
+	}
+	bar := utils.NewBar(count, barB, "")
+	var result utils.DownloadSpeedSet
+	for i := 0; i < testNum; i++ {
+		speed := uploadHandler(speedSet[i].IP)
+		speedSet[i].UploadSpeed = speed
+		// 在每个 IP 上传测速后，以 [上传速度下限] 条件过滤结果
+		if speed >= MinUploadSpeed*1024*1024 {
+			bar.Grow(1, "")
+			result = append(result, speedSet[i])
+			if len(result) == count { // 凑够满足条件的 IP 时，就跳出循环
+				break
+			}
+		}
+	}
+	bar.Done()
+	if MinUploadSpeed == 0 { // 如果没有指定上传速度下限，则返回所有测速数据
+		result = speedSet
+	}
+	if utils.ScoreEnabled() { // 启用综合评分时按评分重新排序（评分可能使用上传速度）
+		sort.Stable(result)
+	}
+	return result
+}
+
+// uploadHandler 通过指定 IP 向上传测速地址 POST 随机数据，返回平均上传速度（字节/秒）
+// 超出下载测速时间时终止上传，以已发送的数据量计算速度
+func uploadHandler(ip *net.IPAddr) float64 {
+	client := &http.Client{
+		Transport: newTransport(ip, downloadTLSConfig()),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse // 上传数据无法随重定向重新发送
+		},
+	}
+	defer closeTransport(ip, client.Transport)
+
+	size := UploadSize * 1024 * 1024
+	body := newUploadBody(size)
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	request, err := newRequest(http.MethodPost, UploadURL)
+	if err != nil {
+		if utils.Debug { // 调试模式下，输出更多信息
+			utils.LogError("IP: %s, 上传测速请求创建失败，错误信息: %v, 上传测速地址: %s", ip.String(), err, UploadURL)
+		}
+		return 0.0
+	}
+	request = request.WithContext(ctx)
+	request.Body = body
+	request.ContentLength = size
+	request.Header.Set("Content-Type", uploadContentType)
+
+	response, err := client.Do(request)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && body.sent.Load() > 0 { // 上传时间用完，以已发送的数据量计算速度
+			return body.speed()
+		}
+		if utils.Debug { // 调试模式下，输出更多信息
+			utils.LogError("IP: %s, 上传测速失败，错误信息: %v, 上传测速地址: %s", ip.String(), err, UploadURL)
+		}
+		return 0.0
+	}
+	speed := body.speed() // 收到响应时数据已全部发送
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxUploadRespBytes))
+	if response.StatusCode >= 400 {
+		if utils.Debug { // 调试模式下，输出更多信息
+			utils.LogError("IP: %s, 上传测速终止，HTTP 状态码: %d, 上传测速地址: %s", ip.String(), response.StatusCode, UploadURL)
+		}
+		return 0.0
+	}
+	return speed
+}
@@ -0,0 +1,154 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+// ipRangeEntry IP 段数据中的一行
+type ipRangeEntry struct {
+	source string // 数据来源
+	line   int    // 行号（ip_text 为第几项）
+	text   string // 原始内容
+	ipNet  *net.IPNet
+	err    error // 解析失败的原因
+}
+
+func (e ipRangeEntry) isIPv4() bool {
+	return e.ipNet.IP.To4() != nil
+}
+
+// ipParseResult IP 段数据的解析结果
+type ipParseResult struct {
+	sources    []string       // 数据来源（文件名、URL、ip_text 或 inline）
+	entries    []ipRangeEntry // 有效且不重复的 IP 段
+	invalid    []ipRangeEntry // 无法解析的 IP 段
+	duplicates []ipRangeEntry // 重复或被其他 IP 段包含的 IP 段
+}
+
+// parseIPRanges 读取并逐行解析 IP 段数据，收集无效及重复的 IP 段，不会因单行错误而退出
+func parseIPRanges() (result ipParseResult, err error) {
+	sources, err := readIPSources()
+	if err != nil {
+		return
+	}
+
+	ranges := newIPRanges()
+	var valid []ipRangeEntry
+	for _, source := range sources {
+		result.sources = append(result.sources, source.name)
+		valid = append(valid, result.parseSource(ranges, source)...)
+	}
+
+	// 按地址族、起始地址、前缀长度排序后，被包含的 IP 段一定紧随包含它的 IP 段之后
+	order := make([]int, len(valid))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		x, y := valid[order[a]].ipNet, valid[order[b]].ipNet
+		if len(x.IP) != len(y.IP) {
+			return len(x.IP) < len(y.IP)
+		}
+		if c := bytes.Compare(x.IP, y.IP); c != 0 {
+			return c < 0
+		}
+		xOnes, _ := x.Mask.Size()
+		yOnes, _ := y.Mask.Size()
+		return xOnes < yOnes
+	})
+	duplicate := make([]bool, len(valid))
+	var last *net.IPNet
+	for _, i := range order {
+		current := valid[i].ipNet
+		if last != nil && len(last.IP) == len(current.IP) && last.Contains(current.IP) {
+			duplicate[i] = true
+			continue
+		}
+		last = current
+	}
+	for i, entry := range valid {
+		if duplicate[i] {
+			result.duplicates = append(result.duplicates, entry)
+		} else {
+			result.entries = append(result.entries, entry)
+		}
+	}
+	return
+}
+
+// parseSource 逐行解析一个数据来源，无效的 IP 段记录到 invalid 中，返回有效的 IP 段
+func (r *ipParseResult) parseSource(ranges *IPRanges, source ipSource) (valid []ipRangeEntry) {
+	for i, line := range source.lines {
+		line = strings.TrimSpace(line) // 去除首尾的空白字符（空格、制表符、换行符等）
+		if line == "" {                // 跳过空行（即开头、结尾或连续多个 ,, 的情况）
+			continue
+		}
+		// 根据当前模式（或数据来源的地址族）决定是否处理该IP（参数中指定的 IP 段不受模式限制）
+		ipv4Only := source.family == "IPv4" || (source.family == "" && IsIPv4Mode())
+		ipv6Only := source.family == "IPv6" || (source.family == "" && IsIPv6Mode())
+		if IPText == "" && ((ipv4Only && !IsIPv4(line)) || (ipv6Only && IsIPv4(line))) {
+			continue // 如果是IPv4模式但IP是IPv6，或者是IPv6模式但IP是IPv4，则跳过
+		}
+		entry := ipRangeEntry{source: source.name, line: i + 1, text: line}
+		if entry.err = ranges.parseCIDR(line); entry.err != nil {
+			r.invalid = append(r.invalid, entry)
+			continue
+		}
+		entry.ipNet = ranges.ipNet
+		valid = append(valid, entry)
+	}
+	return
+}
+
+// report 输出无效及重复的 IP 段
+func (r ipParseResult) report() {
+	for _, entry := range r.invalid {
+		utils.LogWarn("跳过无效的 IP 段 [%s:%d] %s，错误信息: %v", entry.source, entry.line, entry.text, entry.err)
+	}
+	if len(r.duplicates) > 0 {
+		utils.LogInfo("已去除 %d 个重复或被其他 IP 段包含的 IP 段", len(r.duplicates))
+		if utils.Debug { // 调试模式下，输出更多信息
+			for _, entry := range r.duplicates {
+				utils.LogDebug("去除重复的 IP 段 [%s:%d] %s", entry.source, entry.line, entry.text)
+			}
+		}
+	}
+}
+
+// ValidateIPs 校验 IP 段数据并打印每个 IP 段按当前采样设置生成的候选 IP 数量，存在无效的 IP 段时返回 false
+func ValidateIPs() bool {
+	result, err := parseIPRanges()
+	if err != nil {
+		utils.LogError("读取 IP 段数据失败: %v", err)
+		return false
+	}
+
+	ranges := newIPRanges()
+	total := 0
+	fmt.Printf("%-46s%-18s%s\n", "IP 段", "候选 IP 数量", "位置") // 中文字符按显示宽度补齐
+	for _, entry := range result.entries {
+		_ = ranges.parseCIDR(entry.text)
+		count := ranges.candidates(entry.isIPv4()).count
+		total += count
+		fmt.Printf("%-45s%-14d%s:%d\n", entry.text, count, entry.source, entry.line)
+	}
+	for _, entry := range result.duplicates {
+		_, _ = utils.Yellow.Printf("%-45s%-16s%s:%d\n", entry.text, "重复", entry.source, entry.line)
+	}
+	for _, entry := range result.invalid {
+		_, _ = utils.Red.Printf("%-45s%-16s%s:%d (%v)\n", entry.text, "无效", entry.source, entry.line, entry.err)
+	}
+	fmt.Printf("\n数据来源: %s, 有效 IP 段: %d, 重复: %d, 无效: %d, 候选 IP 总数: %d",
+		strings.Join(result.sources, ", "), len(result.entries), len(result.duplicates), len(result.invalid), total)
+	if MaxCandidates > 0 && total > MaxCandidates {
+		fmt.Printf("（超过上限，实际测速 %d 个）", MaxCandidates)
+	}
+	fmt.Println()
+	return len(result.invalid) == 0
+}
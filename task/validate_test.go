@@ -0,0 +1,125 @@
+package task
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setIPSourceTest 设置 IP 段数据来源，测试结束后恢复
+func setIPSourceTest(t *testing.T, ipText, ipFile, ipv4File, ipv6File string) {
+	t.Helper()
+	origText, origFile, origIPv4, origIPv6 := IPText, IPFile, IPv4File, IPv6File
+	IPText, IPFile, IPv4File, IPv6File = ipText, ipFile, ipv4File, ipv6File
+	t.Cleanup(func() {
+		IPText, IPFile, IPv4File, IPv6File = origText, origFile, origIPv4, origIPv6
+	})
+}
+
+// entryTexts 返回 IP 段的原始内容及位置
+func entryTexts(entries []ipRangeEntry) []string {
+	texts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		texts = append(texts, fmt.Sprintf("%s@%s:%d", entry.text, filepath.Base(entry.source), entry.line))
+	}
+	return texts
+}
+
+// nonNil 将 nil 转换为空切片，便于与 entryTexts 的结果比较
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func TestParseIPRanges(t *testing.T) {
+	tests := []struct {
+		name           string
+		ipText         string
+		wantEntries    []string
+		wantDuplicates []string
+		wantInvalid    []string
+	}{
+		{
+			name:           "去除重复及被包含的 IP 段",
+			ipText:         "1.0.0.0/16,1.0.1.0/24,1.0.0.0/16,1.0.200.7,1.1.1.0/24",
+			wantEntries:    []string{"1.0.0.0/16@ip_text:1", "1.1.1.0/24@ip_text:5"},
+			wantDuplicates: []string{"1.0.1.0/24@ip_text:2", "1.0.0.0/16@ip_text:3", "1.0.200.7@ip_text:4"},
+		},
+		{
+			name:           "包含的 IP 段在后",
+			ipText:         "1.0.1.0/24, 1.0.0.0/16",
+			wantEntries:    []string{"1.0.0.0/16@ip_text:2"},
+			wantDuplicates: []string{"1.0.1.0/24@ip_text:1"},
+		},
+		{
+			name:           "IPv4 与 IPv6 互不包含且保持原有顺序",
+			ipText:         "2606:4700::/32,0.0.0.0/0,2606:4700:10::/48,::/0,1.1.1.1",
+			wantEntries:    []string{"0.0.0.0/0@ip_text:2", "::/0@ip_text:4"},
+			wantDuplicates: []string{"2606:4700::/32@ip_text:1", "2606:4700:10::/48@ip_text:3", "1.1.1.1@ip_text:5"},
+		},
+		{
+			name:        "无效的 IP 段不影响其他 IP 段",
+			ipText:      "garbage,1.0.0.0/24,,300.1.1.1/24,1.0.0.0/33,2606:4700::/129, 2606:4700::/32",
+			wantEntries: []string{"1.0.0.0/24@ip_text:2", "2606:4700::/32@ip_text:7"},
+			wantInvalid: []string{"garbage@ip_text:1", "300.1.1.1/24@ip_text:4", "1.0.0.0/33@ip_text:5", "2606:4700::/129@ip_text:6"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setIPSourceTest(t, tt.ipText, "", "", "")
+			result, err := parseIPRanges()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := entryTexts(result.entries); !reflect.DeepEqual(got, nonNil(tt.wantEntries)) {
+				t.Errorf("entries = %v, want %v", got, tt.wantEntries)
+			}
+			if got := entryTexts(result.duplicates); !reflect.DeepEqual(got, nonNil(tt.wantDuplicates)) {
+				t.Errorf("duplicates = %v, want %v", got, tt.wantDuplicates)
+			}
+			if got := entryTexts(result.invalid); !reflect.DeepEqual(got, nonNil(tt.wantInvalid)) {
+				t.Errorf("invalid = %v, want %v", got, tt.wantInvalid)
+			}
+			for _, entry := range result.invalid {
+				if entry.err == nil {
+					t.Errorf("无效的 IP 段 %s 缺少错误信息", entry.text)
+				}
+			}
+		})
+	}
+}
+
+func TestParseIPRangesBothFiles(t *testing.T) {
+	dir := t.TempDir()
+	ipv4File := filepath.Join(dir, "ipv4.txt")
+	ipv6File := filepath.Join(dir, "ipv6.txt")
+	if err := os.WriteFile(ipv4File, []byte("1.0.0.0/24\n2606:4700::/32\n1.2.3/33\n1.0.0.0/16\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ipv6File, []byte("2606:4700::/32\n1.0.0.0/24\n2606:4700::/48\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setIPSourceTest(t, "", "ip.txt", ipv4File, ipv6File)
+
+	result, err := parseIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 各文件只读取对应地址族的 IP 段
+	if got, want := entryTexts(result.entries), []string{"1.0.0.0/16@ipv4.txt:4", "2606:4700::/32@ipv6.txt:1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+	if got, want := entryTexts(result.duplicates), []string{"1.0.0.0/24@ipv4.txt:1", "2606:4700::/48@ipv6.txt:3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("duplicates = %v, want %v", got, want)
+	}
+	if got, want := entryTexts(result.invalid), []string{"1.2.3/33@ipv4.txt:3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid = %v, want %v", got, want)
+	}
+	if IPFile != "ip.txt" {
+		t.Errorf("IPFile = %q, 不应被修改", IPFile)
+	}
+}
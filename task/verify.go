@@ -0,0 +1,120 @@
+package task
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Lyxot/CloudflareSpeedTestDNS/utils"
+)
+
+// 下载测速中 IP 不可用的原因
+const (
+	reasonCertInvalid   = "证书验证失败"
+	reasonPinMismatch   = "证书公钥不匹配"
+	reasonNoCertificate = "未提供证书"
+	reasonContentCheck  = "内容校验失败"
+)
+
+var (
+	VerifyTLS     bool     // 下载测速时是否验证证书
+	VerifyTLSName string   // 验证证书使用的域名，为空时使用 SNI（即 tls_sni 或测速地址的域名）
+	TLSPins       []string // 证书公钥固定，SPKI 的 SHA-256 哈希（Base64），匹配证书链中任意一个即可
+)
+
+// certError 证书验证失败的错误，reason 为不可用原因
+type certError struct {
+	reason string
+	err    error
+}
+
+func (e *certError) Error() string {
+	if e.err == nil {
+		return e.reason
+	}
+	return fmt.Sprintf("%s: %v", e.reason, e.err)
+}
+
+func (e *certError) Unwrap() error {
+	return e.err
+}
+
+// ParseTLSPins 解析英文逗号分隔的证书公钥哈希，支持 sha256/ 前缀，无效的哈希会被跳过并输出警告
+func ParseTLSPins(s string) []string {
+	var pins []string
+	for _, pin := range strings.Split(s, ",") {
+		pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+		if pin == "" {
+			continue
+		}
+		if sum, err := base64.StdEncoding.DecodeString(pin); err != nil || len(sum) != sha256.Size {
+			utils.LogWarn("跳过无效的证书公钥哈希 [%s]，应为 SPKI 的 SHA-256 哈希（Base64）", pin)
+			continue
+		}
+		pins = append(pins, pin)
+	}
+	return pins
+}
+
+// spkiHash 返回证书公钥（SPKI）的 SHA-256 哈希（Base64）
+func spkiHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// downloadTLSConfig 返回下载测速使用的 TLS 配置，未开启 VerifyTLS 时不验证证书
+func downloadTLSConfig() *tls.Config {
+	config := probeTLSConfig(true)
+	if VerifyTLS {
+		// 证书须以 VerifyTLSName 验证，而非握手使用的 SNI，因此跳过默认验证，在 VerifyConnection 中自行验证
+		config.VerifyConnection = verifyConnection
+	}
+	return config
+}
+
+// verifyConnection 验证证书链及域名，并检查证书公钥固定
+func verifyConnection(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return &certError{reason: reasonNoCertificate}
+	}
+	name := VerifyTLSName
+	if name == "" {
+		name = state.ServerName
+	}
+	opts := x509.VerifyOptions{
+		DNSName:       name,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range state.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := state.PeerCertificates[0].Verify(opts); err != nil {
+		return &certError{reason: reasonCertInvalid, err: err}
+	}
+
+	if len(TLSPins) == 0 {
+		return nil
+	}
+	for _, cert := range state.PeerCertificates {
+		hash := spkiHash(cert)
+		for _, pin := range TLSPins {
+			if hash == pin {
+				return nil
+			}
+		}
+	}
+	return &certError{reason: reasonPinMismatch, err: fmt.Errorf("证书公钥哈希: %s", spkiHash(state.PeerCertificates[0]))}
+}
+
+// unusableReason 返回下载测速错误对应的不可用原因，不是证书错误时返回空字符串
+func unusableReason(err error) string {
+	var certErr *certError
+	if errors.As(err, &certErr) {
+		return certErr.reason
+	}
+	return ""
+}
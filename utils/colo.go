@@ -0,0 +1,81 @@
+package utils
+
+import (
+	_ "embed"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+//go:embed colos.csv
+var colosCSV string
+
+// ColoInfo 地区码对应的城市、国家、大洲及地区
+type ColoInfo struct {
+	City      string // 城市
+	Country   string // 国家码（ISO 3166）
+	Continent string // 大洲码，如 AS、EU、NA
+	Region    string // 地区，参照联合国 M49 标准划分，如 EasternAsia
+}
+
+var (
+	coloTable     map[string]ColoInfo // 地区码 -> 地区信息
+	countryTable  map[string]ColoInfo // 国家码 -> 大洲及地区
+	coloTableOnce sync.Once
+
+	regexpColoPrefix = regexp.MustCompile(`^[A-Z]{3}`) // 如 Vercel 的 HKG1，只取前三位地区码
+)
+
+func loadColoTable() {
+	coloTable = make(map[string]ColoInfo)
+	countryTable = make(map[string]ColoInfo)
+	for _, line := range strings.Split(colosCSV, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") { // 跳过空行及注释
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 5 {
+			continue
+		}
+		info := ColoInfo{City: fields[1], Country: fields[2], Continent: fields[3], Region: fields[4]}
+		coloTable[fields[0]] = info
+		countryTable[info.Country] = ColoInfo{Country: info.Country, Continent: info.Continent, Region: info.Region}
+	}
+}
+
+// LookupColo 查询地区码对应的城市、国家、大洲及地区
+// 部分 CDN 只返回国家码（如 CDN77、Bunny），此时只有国家、大洲及地区信息
+func LookupColo(colo string) (ColoInfo, bool) {
+	coloTableOnce.Do(loadColoTable)
+	colo = strings.ToUpper(colo)
+	if info, ok := coloTable[colo]; ok {
+		return info, true
+	}
+	if len(colo) == 2 {
+		info, ok := countryTable[colo]
+		return info, ok
+	}
+	if code := regexpColoPrefix.FindString(colo); code != "" {
+		info, ok := coloTable[code]
+		return info, ok
+	}
+	return ColoInfo{}, false
+}
+
+// ColoCity 返回地区码对应的城市，未知时返回空字符串
+func ColoCity(colo string) string {
+	info, _ := LookupColo(colo)
+	return info.City
+}
+
+// formatColo 在地区码后显示对应的城市，如 SJC(San Jose)
+func formatColo(colo string) string {
+	if colo == "" {
+		return "N/A"
+	}
+	if city := ColoCity(colo); city != "" {
+		return colo + "(" + city + ")"
+	}
+	return colo
+}
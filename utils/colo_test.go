@@ -0,0 +1,48 @@
+package utils
+
+import "testing"
+
+func TestLookupColo(t *testing.T) {
+	tests := []struct {
+		colo   string
+		want   ColoInfo
+		wantOK bool
+	}{
+		{"HKG", ColoInfo{City: "Hong Kong", Country: "HK", Continent: "AS", Region: "EasternAsia"}, true},
+		{"nrt", ColoInfo{City: "Tokyo", Country: "JP", Continent: "AS", Region: "EasternAsia"}, true},
+		{"FRA", ColoInfo{City: "Frankfurt", Country: "DE", Continent: "EU", Region: "WesternEurope"}, true},
+		// 只返回国家码的 CDN，没有城市信息
+		{"JP", ColoInfo{Country: "JP", Continent: "AS", Region: "EasternAsia"}, true},
+		{"de", ColoInfo{Country: "DE", Continent: "EU", Region: "WesternEurope"}, true},
+		// Vercel 等在地区码后附加编号，只取前三位
+		{"HKG1", ColoInfo{City: "Hong Kong", Country: "HK", Continent: "AS", Region: "EasternAsia"}, true},
+		{"sjc12", ColoInfo{City: "San Jose", Country: "US", Continent: "NA", Region: "NorthernAmerica"}, true},
+		{"ZZ", ColoInfo{}, false},
+		{"ZZZ", ColoInfo{}, false},
+		{"ZZZ1", ColoInfo{}, false},
+		{"1HKG", ColoInfo{}, false},
+		{"", ColoInfo{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.colo, func(t *testing.T) {
+			got, ok := LookupColo(tt.colo)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("LookupColo(%q) = %+v, %v, want %+v, %v", tt.colo, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFormatColo(t *testing.T) {
+	for colo, want := range map[string]string{
+		"":     "N/A",
+		"SJC":  "SJC(San Jose)",
+		"HKG1": "HKG1(Hong Kong)",
+		"JP":   "JP",
+		"ZZZ":  "ZZZ",
+	} {
+		if got := formatColo(colo); got != want {
+			t.Errorf("formatColo(%q) = %q, want %q", colo, got, want)
+		}
+	}
+}
@@ -20,6 +20,11 @@ var (
 	InputMaxDelay    = maxDelay
 	InputMinDelay    = minDelay
 	InputMaxLossRate = maxLossRate
+	InputMaxTLSTime  time.Duration // TLS 握手耗时上限，0 表示不限制
+	InputMaxTTFB     time.Duration // 首字节耗时上限，0 表示不限制
+	TLSPhases        = false       // 是否输出 TLS 测速各阶段耗时
+	GeoColumns       = false       // 是否输出 ASN 及地理位置
+	UploadColumns    = false       // 是否输出上传速度
 	Output           = defaultOutput
 	PrintNum         = 10
 	Debug            = false // 是否开启调试模式
@@ -41,12 +46,28 @@ type PingData struct {
 	Received    int
 	Delay       time.Duration
 	Colo        string
+	Samples     []time.Duration // 每次成功测速的延迟样本
+	MinDelay    time.Duration   // 最小延迟
+	MaxDelay    time.Duration   // 最大延迟
+	MedianDelay time.Duration   // 延迟中位数
+	P95Delay    time.Duration   // P95 延迟
+	StdDev      time.Duration   // 延迟标准差
+	Jitter      time.Duration   // 抖动（延迟的平均偏差）
+	ConnectTime time.Duration   // TLS 测速模式下的平均 TCP 连接耗时
+	TLSTime     time.Duration   // TLS 测速模式下的平均 TLS 握手耗时
+	TTFB        time.Duration   // TLS 测速模式下的平均首字节耗时
+	ASN         uint            // 自治系统号，需要配置 MMDB 数据库
+	Org         string          // 自治系统所属组织
+	Country     string          // 国家码（ISO 3166）
+	City        string          // 城市
+	Unusable    string          // 下载测速中判定不可用的原因，如证书验证失败
 }
 
 type CloudflareIPData struct {
 	*PingData
 	lossRate      float32
 	DownloadSpeed float64
+	UploadSpeed   float64 // 上传速度（字节/秒），需要指定上传测速地址
 }
 
 // 计算丢包率
@@ -59,18 +80,39 @@ func (cf *CloudflareIPData) getLossRate() float32 {
 }
 
 func (cf *CloudflareIPData) toString() []string {
-	result := make([]string, 7)
+	result := make([]string, 13, 22)
 	result[0] = cf.IP.String()
 	result[1] = strconv.Itoa(cf.Transmitted)
 	result[2] = strconv.Itoa(cf.Received)
 	result[3] = strconv.FormatFloat(float64(cf.getLossRate()), 'f', 2, 32)
 	result[4] = strconv.FormatFloat(cf.Delay.Seconds()*1000, 'f', 2, 32)
 	result[5] = strconv.FormatFloat(cf.DownloadSpeed/1024/1024, 'f', 2, 32)
-	// 如果 Colo 为空，则使用 "N/A" 表示
-	if cf.Colo == "" {
-		result[6] = "N/A"
-	} else {
-		result[6] = cf.Colo
+	// 如果 Colo 为空，则使用 "N/A" 表示，否则在地区码后显示对应的城市
+	result[6] = formatColo(cf.Colo)
+	result[7] = strconv.FormatFloat(cf.MinDelay.Seconds()*1000, 'f', 2, 32)
+	result[8] = strconv.FormatFloat(cf.MaxDelay.Seconds()*1000, 'f', 2, 32)
+	result[9] = strconv.FormatFloat(cf.MedianDelay.Seconds()*1000, 'f', 2, 32)
+	result[10] = strconv.FormatFloat(cf.P95Delay.Seconds()*1000, 'f', 2, 32)
+	result[11] = strconv.FormatFloat(cf.StdDev.Seconds()*1000, 'f', 2, 32)
+	result[12] = strconv.FormatFloat(cf.Jitter.Seconds()*1000, 'f', 2, 32)
+	if UploadColumns {
+		result = append(result, strconv.FormatFloat(cf.UploadSpeed/1024/1024, 'f', 2, 32))
+	}
+	if scoreFunc != nil {
+		result = append(result, strconv.FormatFloat(cf.Score(), 'f', 2, 64))
+	}
+	if TLSPhases {
+		result = append(result,
+			strconv.FormatFloat(cf.ConnectTime.Seconds()*1000, 'f', 2, 32),
+			strconv.FormatFloat(cf.TLSTime.Seconds()*1000, 'f', 2, 32),
+			strconv.FormatFloat(cf.TTFB.Seconds()*1000, 'f', 2, 32))
+	}
+	if GeoColumns {
+		asn := ""
+		if cf.ASN != 0 {
+			asn = strconv.FormatUint(uint64(cf.ASN), 10)
+		}
+		result = append(result, asn, cf.Org, cf.Country, cf.City)
 	}
 	return result
 }
@@ -91,7 +133,20 @@ func ExportCsv(data []CloudflareIPData) {
 		}
 	}(fp)
 	w := csv.NewWriter(fp) //创建一个新的写入文件流
-	_ = w.Write([]string{"IP 地址", "已发送", "已接收", "丢包率", "平均延迟", "下载速度(MB/s)", "地区码"})
+	header := []string{"IP 地址", "已发送", "已接收", "丢包率", "平均延迟", "下载速度(MB/s)", "地区码", "最小延迟", "最大延迟", "延迟中位数", "P95 延迟", "延迟标准差", "抖动"}
+	if UploadColumns {
+		header = append(header, "上传速度(MB/s)")
+	}
+	if scoreFunc != nil {
+		header = append(header, "综合评分")
+	}
+	if TLSPhases {
+		header = append(header, "TCP 连接耗时", "TLS 握手耗时", "首字节耗时")
+	}
+	if GeoColumns {
+		header = append(header, "ASN", "组织", "国家", "城市")
+	}
+	_ = w.Write(header)
 	_ = w.WriteAll(convertToString(data))
 	w.Flush()
 }
@@ -127,8 +182,11 @@ func (s PingDelaySet) FilterDelay() (data PingDelaySet) {
 		return s
 	}
 	for _, v := range s {
-		if v.Delay > InputMaxDelay { // 平均延迟上限，延迟大于条件最大值时，后面的数据都不满足条件，直接跳出循环
-			break
+		if v.Delay > InputMaxDelay { // 平均延迟上限
+			if SortBy == SortByAverage { // 按平均延迟排序时，延迟大于条件最大值时，后面的数据都不满足条件，直接跳出循环
+				break
+			}
+			continue
 		}
 		if v.Delay < InputMinDelay { // 平均延迟下限，延迟小于条件最小值时，不满足条件，跳过
 			continue
@@ -152,6 +210,23 @@ func (s PingDelaySet) FilterLossRate() (data PingDelaySet) {
 	return
 }
 
+// FilterTLS TLS 握手及首字节耗时条件过滤
+func (s PingDelaySet) FilterTLS() (data PingDelaySet) {
+	if InputMaxTLSTime <= 0 && InputMaxTTFB <= 0 { // 未指定条件时，不进行过滤
+		return s
+	}
+	for _, v := range s {
+		if InputMaxTLSTime > 0 && v.TLSTime > InputMaxTLSTime {
+			continue
+		}
+		if InputMaxTTFB > 0 && v.TTFB > InputMaxTTFB {
+			continue
+		}
+		data = append(data, v)
+	}
+	return
+}
+
 func (s PingDelaySet) Len() int {
 	return len(s)
 }
@@ -160,7 +235,7 @@ func (s PingDelaySet) Less(i, j int) bool {
 	if iRate != jRate {
 		return iRate < jRate
 	}
-	return s[i].Delay < s[j].Delay
+	return s[i].sortDelay() < s[j].sortDelay()
 }
 func (s PingDelaySet) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
@@ -173,12 +248,25 @@ func (s DownloadSpeedSet) Len() int {
 	return len(s)
 }
 func (s DownloadSpeedSet) Less(i, j int) bool {
+	if scoreFunc != nil { // 启用综合评分时按评分排序
+		return s[i].Score() > s[j].Score()
+	}
 	return s[i].DownloadSpeed > s[j].DownloadSpeed
 }
 func (s DownloadSpeedSet) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 
+// FilterUsable 去除下载测速中判定不可用的 IP
+func (s DownloadSpeedSet) FilterUsable() (data DownloadSpeedSet) {
+	for _, v := range s {
+		if v.Unusable == "" {
+			data = append(data, v)
+		}
+	}
+	return
+}
+
 // FilterIPv4 过滤出 IPv4 数据
 func (s DownloadSpeedSet) FilterIPv4() []IPData {
 	var result []IPData
@@ -192,7 +280,23 @@ func (s DownloadSpeedSet) FilterIPv4() []IPData {
 				LossRate: data.getLossRate(),
 				Delay:    int64(data.Delay / time.Millisecond),
 				Speed:    data.DownloadSpeed / 1024 / 1024, // 转为 MB/s
+				Upload:   data.UploadSpeed / 1024 / 1024,
 				Colo:     data.Colo,
+				ColoCity: ColoCity(data.Colo),
+
+				MinDelay:    int64(data.MinDelay / time.Millisecond),
+				MaxDelay:    int64(data.MaxDelay / time.Millisecond),
+				MedianDelay: int64(data.MedianDelay / time.Millisecond),
+				P95Delay:    int64(data.P95Delay / time.Millisecond),
+				StdDev:      int64(data.StdDev / time.Millisecond),
+				Jitter:      int64(data.Jitter / time.Millisecond),
+				ConnectTime: int64(data.ConnectTime / time.Millisecond),
+				TLSTime:     int64(data.TLSTime / time.Millisecond),
+				TTFB:        int64(data.TTFB / time.Millisecond),
+				ASN:         data.ASN,
+				Org:         data.Org,
+				Country:     data.Country,
+				City:        data.City,
 			})
 		}
 	}
@@ -212,7 +316,23 @@ func (s DownloadSpeedSet) FilterIPv6() []IPData {
 				LossRate: data.getLossRate(),
 				Delay:    int64(data.Delay / time.Millisecond),
 				Speed:    data.DownloadSpeed / 1024 / 1024, // 转为 MB/s
+				Upload:   data.UploadSpeed / 1024 / 1024,
 				Colo:     data.Colo,
+				ColoCity: ColoCity(data.Colo),
+
+				MinDelay:    int64(data.MinDelay / time.Millisecond),
+				MaxDelay:    int64(data.MaxDelay / time.Millisecond),
+				MedianDelay: int64(data.MedianDelay / time.Millisecond),
+				P95Delay:    int64(data.P95Delay / time.Millisecond),
+				StdDev:      int64(data.StdDev / time.Millisecond),
+				Jitter:      int64(data.Jitter / time.Millisecond),
+				ConnectTime: int64(data.ConnectTime / time.Millisecond),
+				TLSTime:     int64(data.TLSTime / time.Millisecond),
+				TTFB:        int64(data.TTFB / time.Millisecond),
+				ASN:         data.ASN,
+				Org:         data.Org,
+				Country:     data.Country,
+				City:        data.City,
 			})
 		}
 	}
@@ -227,7 +347,24 @@ type IPData struct {
 	LossRate float32 // 丢包率
 	Delay    int64   // 延迟（毫秒）
 	Speed    float64 // 下载速度（MB/s）
+	Upload   float64 // 上传速度（MB/s），需要指定上传测速地址
 	Colo     string  // 地区码
+	ColoCity string  // 地区码对应的城市
+
+	MinDelay    int64 // 最小延迟（毫秒）
+	MaxDelay    int64 // 最大延迟（毫秒）
+	MedianDelay int64 // 延迟中位数（毫秒）
+	P95Delay    int64 // P95 延迟（毫秒）
+	StdDev      int64 // 延迟标准差（毫秒）
+	Jitter      int64 // 抖动（毫秒）
+	ConnectTime int64 // TCP 连接耗时（毫秒），仅 TLS 测速模式
+	TLSTime     int64 // TLS 握手耗时（毫秒），仅 TLS 测速模式
+	TTFB        int64 // 首字节耗时（毫秒），仅 TLS 测速模式
+
+	ASN     uint   // 自治系统号，仅配置 MMDB 数据库时
+	Org     string // 自治系统所属组织
+	Country string // 国家码（ISO 3166）
+	City    string // 城市
 }
 
 func (s DownloadSpeedSet) Print() {
@@ -251,9 +388,18 @@ func (s DownloadSpeedSet) Print() {
 			break
 		}
 	}
-	LogInfo(headFormat, "IP 地址", "已发送", "已接收", "丢包率", "平均延迟", "下载速度(MB/s)", "地区码")
-	for i := 0; i < PrintNum; i++ {
-		LogInfo(dataFormat, dataString[i][0], dataString[i][1], dataString[i][2], dataString[i][3], dataString[i][4], dataString[i][5], dataString[i][6])
+	if UploadColumns { // 在下载速度后显示上传速度
+		headFormat = headFormat[:len(headFormat)-4] + "%-12s%-5s"
+		dataFormat = dataFormat[:len(dataFormat)-4] + "%-16s%-8s"
+		LogInfo(headFormat, "IP 地址", "已发送", "已接收", "丢包率", "平均延迟", "下载速度(MB/s)", "上传速度(MB/s)", "地区码")
+		for i := 0; i < PrintNum; i++ {
+			LogInfo(dataFormat, dataString[i][0], dataString[i][1], dataString[i][2], dataString[i][3], dataString[i][4], dataString[i][5], dataString[i][13], dataString[i][6])
+		}
+	} else {
+		LogInfo(headFormat, "IP 地址", "已发送", "已接收", "丢包率", "平均延迟", "下载速度(MB/s)", "地区码")
+		for i := 0; i < PrintNum; i++ {
+			LogInfo(dataFormat, dataString[i][0], dataString[i][1], dataString[i][2], dataString[i][3], dataString[i][4], dataString[i][5], dataString[i][6])
+		}
 	}
 	if !noOutput() {
 		LogInfo("完整测速结果已写入 %v 文件，可使用记事本/表格软件查看。", Output)
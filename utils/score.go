@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// scoreExpr 根据测速数据计算分数的函数
+type scoreExpr = func(cf *CloudflareIPData) float64
+
+// scoreFunc 综合评分函数，分数越高排名越靠前；为 nil 时按下载速度排序
+var scoreFunc scoreExpr
+
+// ScoreEnabled 是否按综合评分排序
+func ScoreEnabled() bool {
+	return scoreFunc != nil
+}
+
+// Score 返回 IP 的综合评分，未启用综合评分时返回 0
+func (cf *CloudflareIPData) Score() float64 {
+	if scoreFunc == nil {
+		return 0
+	}
+	return scoreFunc(cf)
+}
+
+// scoreVariables 评分表达式中可使用的变量，延迟类变量单位为毫秒
+var scoreVariables = map[string]scoreExpr{
+	"speed":  func(cf *CloudflareIPData) float64 { return cf.DownloadSpeed / 1024 / 1024 }, // 下载速度 (MB/s)
+	"upload": func(cf *CloudflareIPData) float64 { return cf.UploadSpeed / 1024 / 1024 },   // 上传速度 (MB/s)
+	"delay":  func(cf *CloudflareIPData) float64 { return milliseconds(cf.Delay) },
+	"loss":   func(cf *CloudflareIPData) float64 { return float64(cf.getLossRate()) }, // 丢包率 (0~1)
+	"jitter": func(cf *CloudflareIPData) float64 { return milliseconds(cf.Jitter) },
+	"min":    func(cf *CloudflareIPData) float64 { return milliseconds(cf.MinDelay) },
+	"max":    func(cf *CloudflareIPData) float64 { return milliseconds(cf.MaxDelay) },
+	"median": func(cf *CloudflareIPData) float64 { return milliseconds(cf.MedianDelay) },
+	"p95":    func(cf *CloudflareIPData) float64 { return milliseconds(cf.P95Delay) },
+	"stddev": func(cf *CloudflareIPData) float64 { return milliseconds(cf.StdDev) },
+	"tls":    func(cf *CloudflareIPData) float64 { return milliseconds(cf.TLSTime) },
+	"ttfb":   func(cf *CloudflareIPData) float64 { return milliseconds(cf.TTFB) },
+}
+
+// SetWeightedScore 按权重计算综合评分：
+// 速度权重 × 下载速度(MB/s) - 延迟权重 × 平均延迟(ms) - 丢包惩罚 × 丢包率(0~1) - 抖动惩罚 × 抖动(ms)
+func SetWeightedScore(speedWeight, delayWeight, lossPenalty, jitterPenalty float64) {
+	scoreFunc = func(cf *CloudflareIPData) float64 {
+		return speedWeight*cf.DownloadSpeed/1024/1024 -
+			delayWeight*milliseconds(cf.Delay) -
+			lossPenalty*float64(cf.getLossRate()) -
+			jitterPenalty*milliseconds(cf.Jitter)
+	}
+}
+
+// SetScoreExpression 使用自定义表达式计算综合评分，支持 + - * / 及括号，变量见 scoreVariables
+func SetScoreExpression(expression string) error {
+	p := &exprParser{tokens: tokenize(expression)}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return fmt.Errorf("解析评分表达式 [%s] 失败: %v", expression, err)
+	}
+	if p.pos < len(p.tokens) {
+		return fmt.Errorf("解析评分表达式 [%s] 失败: 多余的内容 [%s]", expression, p.tokens[p.pos])
+	}
+	scoreFunc = expr
+	return nil
+}
+
+// milliseconds 将时长转换为毫秒
+func milliseconds(d time.Duration) float64 {
+	return d.Seconds() * 1000
+}
+
+// tokenize 将表达式拆分为数字、变量名、运算符及括号
+func tokenize(expression string) []string {
+	var tokens []string
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || r == '.' || unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.' || unicode.IsLetter(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			tokens = append(tokens, string(r))
+			i++
+		}
+	}
+	return tokens
+}
+
+// exprParser 评分表达式的递归下降解析器
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// parseExpr 解析加减运算
+func (p *exprParser) parseExpr() (scoreExpr, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == "+" || op == "-"; op = p.peek() {
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "+" {
+			left = func(cf *CloudflareIPData) float64 { return l(cf) + right(cf) }
+		} else {
+			left = func(cf *CloudflareIPData) float64 { return l(cf) - right(cf) }
+		}
+	}
+	return left, nil
+}
+
+// parseTerm 解析乘除运算，除数为 0 时结果为 0
+func (p *exprParser) parseTerm() (scoreExpr, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == "*" || op == "/"; op = p.peek() {
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "*" {
+			left = func(cf *CloudflareIPData) float64 { return l(cf) * right(cf) }
+		} else {
+			left = func(cf *CloudflareIPData) float64 {
+				if r := right(cf); r != 0 {
+					return l(cf) / r
+				}
+				return 0
+			}
+		}
+	}
+	return left, nil
+}
+
+// parseFactor 解析数字、变量、括号及负号
+func (p *exprParser) parseFactor() (scoreExpr, error) {
+	token := p.peek()
+	p.pos++
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("表达式不完整")
+	case token == "-":
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return func(cf *CloudflareIPData) float64 { return -operand(cf) }, nil
+	case token == "(":
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("缺少右括号")
+		}
+		p.pos++
+		return expr, nil
+	}
+	if value, err := strconv.ParseFloat(token, 64); err == nil {
+		return func(*CloudflareIPData) float64 { return value }, nil
+	}
+	if variable, ok := scoreVariables[strings.ToLower(token)]; ok {
+		return variable, nil
+	}
+	return nil, fmt.Errorf("未知的变量或符号 [%s]", token)
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSetScoreExpression(t *testing.T) {
+	t.Cleanup(func() { scoreFunc = nil })
+
+	data := &CloudflareIPData{
+		PingData: &PingData{
+			Transmitted: 4,
+			Received:    3,
+			Delay:       50 * time.Millisecond,
+			Jitter:      4 * time.Millisecond,
+		},
+		DownloadSpeed: 20 * 1024 * 1024, // 20 MB/s
+		UploadSpeed:   5 * 1024 * 1024,  // 5 MB/s
+	}
+
+	tests := []struct {
+		expression string
+		want       float64
+	}{
+		{"speed", 20},
+		{"speed - delay*2", -80},
+		{"speed - delay * 2 + upload", -75},
+		{"(speed - delay) * 2", -60},
+		{"speed / 4 / 5", 1},
+		{"2 * (3 + 4) - 1", 13},
+		{"-speed", -20},
+		{"-speed * 2", -40},
+		{"- (speed + upload)", -25},
+		{"--delay", 50},
+		{"speed - -delay", 70},
+		{"speed / 0", 0},
+		{"speed / (delay - delay) + 1", 1},
+		{"loss * 100", 25},
+		{"SPEED + Jitter", 24},
+		{"1.5 * upload", 7.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			if err := SetScoreExpression(tt.expression); err != nil {
+				t.Fatalf("SetScoreExpression(%q) error = %v", tt.expression, err)
+			}
+			if got := data.Score(); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Score() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetScoreExpressionInvalid(t *testing.T) {
+	t.Cleanup(func() { scoreFunc = nil })
+
+	for _, expression := range []string{
+		"",
+		"speed +",
+		"speed * ",
+		"(speed - delay",
+		"speed )",
+		"speed delay",
+		"bandwidth * 2",
+		"speed % 2",
+		"1..2",
+		"()",
+	} {
+		t.Run(expression, func(t *testing.T) {
+			scoreFunc = nil
+			if err := SetScoreExpression(expression); err == nil {
+				t.Errorf("SetScoreExpression(%q) error = nil, want error", expression)
+			}
+			if ScoreEnabled() {
+				t.Errorf("SetScoreExpression(%q) 失败后不应启用综合评分", expression)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	SortByAverage = "avg"    // 按平均延迟排序
+	SortByMedian  = "median" // 按延迟中位数排序
+	SortByP95     = "p95"    // 按 P95 延迟排序
+	SortByMax     = "max"    // 按最大延迟排序
+	SortByJitter  = "jitter" // 按抖动排序
+)
+
+var (
+	SortBy         = SortByAverage // 延迟排序依据（丢包率相同时）
+	InputMaxJitter time.Duration   // 抖动上限，0 表示不限制
+	InputMaxP95    time.Duration   // P95 延迟上限，0 表示不限制
+)
+
+// SetSamples 保存每次成功测速的延迟样本，并计算平均延迟及延迟统计数据
+func (d *PingData) SetSamples(samples []time.Duration) {
+	d.Samples = samples
+	if len(samples) == 0 {
+		return
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, v := range sorted {
+		total += v
+	}
+	mean := total / time.Duration(len(sorted))
+
+	var deviation time.Duration
+	var variance float64
+	for _, v := range sorted {
+		diff := v - mean
+		if diff < 0 {
+			diff = -diff
+		}
+		deviation += diff
+		variance += float64(diff) * float64(diff)
+	}
+
+	d.Delay = mean
+	d.MinDelay = sorted[0]
+	d.MaxDelay = sorted[len(sorted)-1]
+	d.MedianDelay = median(sorted)
+	d.P95Delay = percentile(sorted, 0.95)
+	d.StdDev = time.Duration(math.Sqrt(variance / float64(len(sorted))))
+	d.Jitter = deviation / time.Duration(len(sorted)) // 平均偏差
+}
+
+// median 计算已排序样本的中位数
+func median(sorted []time.Duration) time.Duration {
+	n := len(sorted)
+	if n%2 == 0 {
+		return (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	return sorted[n/2]
+}
+
+// percentile 使用最近秩法计算已排序样本的百分位数
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+// sortDelay 返回按 SortBy 排序时使用的延迟
+func (d *PingData) sortDelay() time.Duration {
+	switch SortBy {
+	case SortByMedian:
+		return d.MedianDelay
+	case SortByP95:
+		return d.P95Delay
+	case SortByMax:
+		return d.MaxDelay
+	case SortByJitter:
+		return d.Jitter
+	}
+	return d.Delay
+}
+
+// FilterStats 抖动及 P95 延迟条件过滤
+func (s PingDelaySet) FilterStats() (data PingDelaySet) {
+	if InputMaxJitter <= 0 && InputMaxP95 <= 0 { // 未指定条件时，不进行过滤
+		return s
+	}
+	for _, v := range s {
+		if InputMaxJitter > 0 && v.Jitter > InputMaxJitter {
+			continue
+		}
+		if InputMaxP95 > 0 && v.P95Delay > InputMaxP95 {
+			continue
+		}
+		data = append(data, v)
+	}
+	return
+}